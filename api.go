@@ -0,0 +1,649 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/db"
+	"app/export"
+	"app/traceroute"
+)
+
+// defaultAPIAddr is where the API listens unless told otherwise.
+const defaultAPIAddr = "127.0.0.1:8470"
+
+// apiServer exposes an App over HTTP for scripts and dashboards.  The
+// window serves it when enabled in its APISettings, and the serve command
+// runs it without a window.  Every request must carry the token, as "Authorization: Bearer <token>" or, for
+// EventSource clients that cannot set headers, a token query parameter.
+//
+//	POST   /api/sessions               start a trace: {"host": ..., "options": {...}}
+//	DELETE /api/sessions/{id}          stop a trace
+//	GET    /api/events[?session=id]    Server-Sent Events, as sent to the GUI
+//	GET    /api/history                ?destination=&limit=
+//	GET    /api/traces                 search: the db.TraceQuery fields as parameters
+//	DELETE /api/traces                 ?destination=&from=&to=, at least one
+//	GET    /api/traces/{id}            a trace and its hops
+//	GET    /api/traces/{id}/export     ?format=json|csv|text
+//	DELETE /api/traces/{id}
+//	POST   /api/import                 traceroute, tracert or mtr output; ?source=
+//	GET    /api/series                 ?destination=&bucket=&from=&to=
+//	GET    /api/path-changes           ?destination=&limit=
+//	GET    /api/compare                ?from=&to=
+//
+// Starting a trace with "Accept: text/event-stream" streams its events in
+// the response, from a "session" event carrying its ID to the one that ends
+// it; the trace is stopped if the client goes away first.
+type apiServer struct {
+	app   *App
+	token string
+}
+
+// serveAPI serves the API for a on addr, which must be a loopback address,
+// until ctx is cancelled.
+func serveAPI(ctx context.Context, a *App, addr, token string) error {
+	ln, err := listenAPI(addr, token)
+	if err != nil {
+		return err
+	}
+	return serveAPIOn(ctx, a, ln, token)
+}
+
+// listenAPI checks the address and token the API is to use and opens its
+// listener.
+func listenAPI(addr, token string) (net.Listener, error) {
+	if token == "" {
+		return nil, errors.New("the API needs a token")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("the API only listens on loopback addresses, not %s", host)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serveAPIOn serves the API for a on ln until ctx is cancelled.  It returns
+// once ln is closed.
+func serveAPIOn(ctx context.Context, a *App, ln net.Listener, token string) error {
+	s := &apiServer{app: a, token: token}
+	srv := &http.Server{
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("API listening on http://%s/api/", ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newAPIToken returns a random token for the API.
+func newAPIToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// APISettings control the API the app serves while its window is open.  The
+// serve command takes the address and token from its flags instead.
+type APISettings struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`  // loopback host:port
+	Token   string `json:"token"` // sent by clients as a bearer token
+}
+
+// apiSettingsKey is the settings row holding APISettings as JSON.
+const apiSettingsKey = "api"
+
+// GetAPISettings returns the API settings, with the default address and a
+// fresh token filled in until the user has saved some.
+func (a *App) GetAPISettings() APISettings {
+	s := APISettings{Addr: defaultAPIAddr}
+	if a.db != nil {
+		if _, err := a.db.Setting(apiSettingsKey, &s); err != nil {
+			a.logErrorf("GetAPISettings: %v", err)
+		}
+	}
+	if s.Token == "" {
+		s.Token, _ = newAPIToken()
+	}
+	return s
+}
+
+// SetAPISettings saves s and starts, restarts or stops the API to match.  An
+// empty address or token is replaced by the default address or a new
+// token; the settings as saved are returned.  If the API cannot listen on
+// the new address, the old settings stay in effect.
+func (a *App) SetAPISettings(s APISettings) (APISettings, error) {
+	if a.db == nil {
+		return s, errors.New("history database is not available")
+	}
+	if s.Addr == "" {
+		s.Addr = defaultAPIAddr
+	}
+	if s.Token == "" {
+		token, err := newAPIToken()
+		if err != nil {
+			return s, err
+		}
+		s.Token = token
+	}
+
+	old := a.GetAPISettings()
+	a.stopAPI()
+	if s.Enabled {
+		if err := a.startAPI(s); err != nil {
+			if old.Enabled {
+				if err := a.startAPI(old); err != nil {
+					a.logErrorf("API: %v", err)
+				}
+			}
+			return old, err
+		}
+	}
+	if err := a.db.SetSetting(apiSettingsKey, s); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// startAPI starts serving the API in the background with s, once any
+// earlier server has been stopped with stopAPI.
+func (a *App) startAPI(s APISettings) error {
+	ln, err := listenAPI(s.Addr, s.Token)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := serveAPIOn(ctx, a, ln, s.Token); err != nil {
+			a.logErrorf("API: %v", err)
+		}
+	}()
+	a.apiMu.Lock()
+	a.apiStop = func() { cancel(); <-done }
+	a.apiMu.Unlock()
+	return nil
+}
+
+// stopAPI stops the API started by startAPI, if it is running, and waits
+// until its address is free again.
+func (a *App) stopAPI() {
+	a.apiMu.Lock()
+	stop := a.apiStop
+	a.apiStop = nil
+	a.apiMu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/sessions", s.startTrace)
+	mux.HandleFunc("DELETE /api/sessions/{id}", s.stopTrace)
+	mux.HandleFunc("GET /api/events", s.events)
+	mux.HandleFunc("GET /api/history", s.history)
+	mux.HandleFunc("GET /api/traces", s.searchTraces)
+	mux.HandleFunc("DELETE /api/traces", s.deleteTraces)
+	mux.HandleFunc("GET /api/traces/{id}", s.getTrace)
+	mux.HandleFunc("GET /api/traces/{id}/export", s.exportTrace)
+	mux.HandleFunc("DELETE /api/traces/{id}", s.deleteTrace)
+	mux.HandleFunc("POST /api/import", s.importTrace)
+	mux.HandleFunc("GET /api/series", s.hopSeries)
+	mux.HandleFunc("GET /api/path-changes", s.pathChanges)
+	mux.HandleFunc("GET /api/compare", s.compare)
+	return s.authorize(mux)
+}
+
+// authorize rejects requests without the token.
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startRequest is the body of POST /api/sessions.  Options not given take
+// their defaults.
+type startRequest struct {
+	Host    string          `json:"host"`
+	Options json.RawMessage `json:"options"`
+}
+
+func (s *apiServer) startTrace(w http.ResponseWriter, r *http.Request) {
+	var req startRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Host == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("no host"))
+		return
+	}
+	opts := traceroute.DefaultOptions()
+	if len(req.Options) > 0 {
+		if err := json.Unmarshal(req.Options, opts); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("bad options: %w", err))
+			return
+		}
+	}
+	start := func() int64 { return s.app.StartTraceroute(req.Host, *opts) }
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.stream(w, r, 0, start)
+		return
+	}
+	writeAPIJSON(w, map[string]int64{"sessionId": start()})
+}
+
+func (s *apiServer) stopTrace(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.app.StopTraceroute(id) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no running session %d", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) events(w http.ResponseWriter, r *http.Request) {
+	session, err := intParam(r, "session")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.stream(w, r, int64(session), nil)
+}
+
+// keepAlive is how often an idle event stream sends a comment, so proxies
+// and clients do not time it out.
+const keepAlive = 15 * time.Second
+
+// stream sends events as Server-Sent Events until the client goes away:
+// every event, or only session's when it is not 0.  With start, it starts a
+// trace once subscribed, so that no hop is missed, follows that session,
+// and returns after the event that ends it, stopping the trace if the
+// client leaves sooner.
+func (s *apiServer) stream(w http.ResponseWriter, r *http.Request, session int64, start func() int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	events, unsubscribe := s.app.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if start != nil {
+		session = start()
+		writeEvent(w, "session", map[string]int64{"sessionId": session})
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			if start != nil {
+				s.app.StopTraceroute(session)
+			}
+			return
+		case <-ticker.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return // fell too far behind
+			}
+			if session != 0 && e.Session != session {
+				continue
+			}
+			var data any = e.Data
+			if len(e.Data) == 1 {
+				data = e.Data[0]
+			}
+			writeEvent(w, e.Name, data)
+			flusher.Flush()
+			if start != nil && finalEvent(e.Name) {
+				return
+			}
+		}
+	}
+}
+
+// finalEvent reports whether name is the last event of a session.
+func finalEvent(name string) bool {
+	switch name {
+	case "traceroute:done", "traceroute:maxhops", "traceroute:error":
+		return true
+	}
+	return false
+}
+
+func writeEvent(w io.Writer, name string, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		b, _ = json.Marshal(err.Error())
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+}
+
+func (s *apiServer) history(w http.ResponseWriter, r *http.Request) {
+	limit, err := intParam(r, "limit")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit <= 0 {
+		limit = db.DefaultSearchLimit
+	}
+	records := s.app.GetHistory(r.URL.Query().Get("destination"), limit)
+	if records == nil {
+		records = []db.TraceRecord{}
+	}
+	writeAPIJSON(w, records)
+}
+
+func (s *apiServer) searchTraces(w http.ResponseWriter, r *http.Request) {
+	q, err := traceQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.app.SearchTraces(q)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, res)
+}
+
+// traceQuery reads a db.TraceQuery from URL parameters named like its JSON
+// fields.
+func traceQuery(r *http.Request) (db.TraceQuery, error) {
+	p := r.URL.Query()
+	q := db.TraceQuery{
+		Destination: p.Get("destination"),
+		HopIP:       p.Get("hopIp"),
+		Hostname:    p.Get("hostname"),
+	}
+	var err error
+	if q.Since, q.Until, err = parseRange(p.Get("since"), p.Get("until")); err != nil {
+		return q, err
+	}
+	if v := p.Get("reached"); v != "" {
+		reached, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("bad reached: %w", err)
+		}
+		q.Reached = &reached
+	}
+	if q.MinRTT, err = floatParam(r, "minRtt"); err != nil {
+		return q, err
+	}
+	if q.MaxRTT, err = floatParam(r, "maxRtt"); err != nil {
+		return q, err
+	}
+	if q.Offset, err = intParam(r, "offset"); err != nil {
+		return q, err
+	}
+	q.Limit, err = intParam(r, "limit")
+	return q, err
+}
+
+func (s *apiServer) deleteTraces(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query()
+	// Like the delete command, never take a bare request to mean everything.
+	if p.Get("destination") == "" && p.Get("from") == "" && p.Get("to") == "" {
+		writeAPIError(w, http.StatusBadRequest, errNoDeleteFilter)
+		return
+	}
+	n, err := s.app.DeleteTraces(p.Get("destination"), p.Get("from"), p.Get("to"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeAPIJSON(w, map[string]int64{"deleted": n})
+}
+
+// traceResponse is the body of GET /api/traces/{id}.
+type traceResponse struct {
+	db.TraceRecord
+	Hops []db.HopRecord `json:"hops"`
+}
+
+func (s *apiServer) getTrace(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.trace(w, r)
+	if ok {
+		writeAPIJSON(w, traceResponse{t.TraceRecord, t.Hops})
+	}
+}
+
+func (s *apiServer) exportTrace(w http.ResponseWriter, r *http.Request) {
+	f := export.Format(r.URL.Query().Get("format"))
+	if f == "" {
+		f = export.FormatJSON
+	}
+	if !slices.Contains(export.Formats, f) {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("unknown export format %q", f))
+		return
+	}
+	t, ok := s.trace(w, r)
+	if !ok {
+		return
+	}
+	// Render first, so a failure can still be reported with a status.
+	var buf bytes.Buffer
+	if err := export.Write(&buf, f, t); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	switch f {
+	case export.FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case export.FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+	}
+	buf.WriteTo(w)
+}
+
+// trace loads the trace named in the path, writing the error response if
+// it cannot.
+func (s *apiServer) trace(w http.ResponseWriter, r *http.Request) (export.Trace, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return export.Trace{}, false
+	}
+	if s.app.db == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, errors.New("history database is not available"))
+		return export.Trace{}, false
+	}
+	record, err := s.app.db.GetTraceRecord(id)
+	if errors.Is(err, db.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no trace %d", id))
+		return export.Trace{}, false
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return export.Trace{}, false
+	}
+	hops, err := s.app.db.GetTrace(id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return export.Trace{}, false
+	}
+	if hops == nil {
+		hops = []db.HopRecord{}
+	}
+	return export.Trace{TraceRecord: record, Hops: hops}, true
+}
+
+func (s *apiServer) deleteTrace(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	err = s.app.DeleteTrace(id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no trace %d", id))
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// maxImportSize bounds the body of POST /api/import.
+const maxImportSize = 1 << 20
+
+func (s *apiServer) importTrace(w http.ResponseWriter, r *http.Request) {
+	text, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, err := s.app.ImportTrace(string(text), r.URL.Query().Get("source"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeAPIJSON(w, map[string]int64{"id": id})
+}
+
+func (s *apiServer) hopSeries(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query()
+	bucket := p.Get("bucket")
+	if bucket == "" {
+		bucket = db.BucketHour
+	}
+	series, err := s.app.GetHopSeries(p.Get("destination"), bucket, p.Get("from"), p.Get("to"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeAPIJSON(w, series)
+}
+
+func (s *apiServer) pathChanges(w http.ResponseWriter, r *http.Request) {
+	limit, err := intParam(r, "limit")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit <= 0 {
+		limit = db.DefaultSearchLimit
+	}
+	records := s.app.GetPathChanges(r.URL.Query().Get("destination"), limit)
+	if records == nil {
+		records = []db.PathChangeRecord{}
+	}
+	writeAPIJSON(w, records)
+}
+
+func (s *apiServer) compare(w http.ResponseWriter, r *http.Request) {
+	from, err := intParam(r, "from")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := intParam(r, "to")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	diff, err := s.app.CompareTraces(int64(from), int64(to))
+	if errors.Is(err, db.ErrNotFound) {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, diff)
+}
+
+// intParam returns URL parameter name as an int, 0 if it is absent.
+func intParam(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// floatParam returns URL parameter name as a float64, 0 if it is absent.
+func floatParam(r *http.Request, name string) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %w", name, err)
+	}
+	return f, nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"app/db"
+)
+
+const testToken = "secret"
+
+// newTestAPI returns an API server for an App whose history lives in a
+// temporary data dir.
+func newTestAPI(t *testing.T) (*App, http.Handler) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir) // Linux and BSDs
+	t.Setenv("HOME", dir)            // macOS
+	t.Setenv("AppData", dir)         // Windows
+	database, err := db.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	a := NewApp()
+	a.db = database
+	return a, (&apiServer{app: a, token: testToken}).routes()
+}
+
+// do sends an authorized request to h and returns the recorded response.
+func do(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func saveTestTrace(t *testing.T, a *App, destination string) int64 {
+	t.Helper()
+	id, err := a.db.SaveTrace(destination, db.TraceRun{Status: db.StatusDone}, []db.HopRecord{
+		{TTL: 1, IP: "192.0.2.1", Success: true, IsFinal: true, RTT: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAPIDeleteTraces(t *testing.T) {
+	a, h := newTestAPI(t)
+	saveTestTrace(t, a, "example.com")
+	saveTestTrace(t, a, "example.net")
+
+	tests := []struct {
+		target  string
+		status  int
+		deleted int64
+		left    int
+	}{
+		// A bare request must not clear the history.
+		{"/api/traces", http.StatusBadRequest, 0, 2},
+		{"/api/traces?destination=&from=&to=", http.StatusBadRequest, 0, 2},
+		{"/api/traces?from=yesterday", http.StatusBadRequest, 0, 2},
+		{"/api/traces?destination=example.com", http.StatusOK, 1, 1},
+		{"/api/traces?to=2000-01-01T00:00:00Z", http.StatusOK, 0, 1},
+		{"/api/traces?from=2000-01-01T00:00:00Z", http.StatusOK, 1, 0},
+	}
+	for _, tt := range tests {
+		rec := do(h, http.MethodDelete, tt.target)
+		if rec.Code != tt.status {
+			t.Fatalf("DELETE %s: status %d, want %d: %s", tt.target, rec.Code, tt.status, rec.Body)
+		}
+		if tt.status == http.StatusOK {
+			var body struct{ Deleted int64 }
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Deleted != tt.deleted {
+				t.Errorf("DELETE %s: deleted %d, want %d", tt.target, body.Deleted, tt.deleted)
+			}
+		}
+		if n := len(a.GetHistory("", 10)); n != tt.left {
+			t.Errorf("after DELETE %s: %d traces left, want %d", tt.target, n, tt.left)
+		}
+	}
+}
+
+func TestAPIUnauthorized(t *testing.T) {
+	a, h := newTestAPI(t)
+	saveTestTrace(t, a, "example.com")
+	req := httptest.NewRequest(http.MethodDelete, "/api/traces?destination=example.com", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if n := len(a.GetHistory("", 10)); n != 1 {
+		t.Errorf("%d traces left, want 1", n)
+	}
+}
+
+func TestAPIDeleteTrace(t *testing.T) {
+	a, h := newTestAPI(t)
+	id := saveTestTrace(t, a, "example.com")
+	target := fmt.Sprintf("/api/traces/%d", id)
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{target, http.StatusNoContent},
+		{target, http.StatusNotFound},
+		{"/api/traces/999", http.StatusNotFound},
+		{"/api/traces/x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := do(h, http.MethodDelete, tt.target); rec.Code != tt.status {
+			t.Errorf("DELETE %s: status %d, want %d: %s", tt.target, rec.Code, tt.status, rec.Body)
+		}
+	}
+
+	// A failing database is not reported as success or as a missing trace.
+	a.db.Close()
+	if rec := do(h, http.MethodDelete, "/api/traces/1"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("DELETE with the database closed: status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestAPIStopUnknownSession(t *testing.T) {
+	_, h := newTestAPI(t)
+	if rec := do(h, http.MethodDelete, "/api/sessions/42"); rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(h, http.MethodDelete, "/api/sessions/x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// freeAddr returns a loopback address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get requests the history from the API at addr, returning the status or
+// 0 if nothing answered.
+func get(addr, token string) int {
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/api/history", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAPISettings(t *testing.T) {
+	a, _ := newTestAPI(t)
+	a.ctx = context.Background()
+	t.Cleanup(a.stopAPI)
+
+	if s := a.GetAPISettings(); s.Enabled || s.Addr != defaultAPIAddr || s.Token == "" {
+		t.Errorf("default settings = %+v", s)
+	}
+
+	addr := freeAddr(t)
+	s, err := a.SetAPISettings(APISettings{Enabled: true, Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Token == "" {
+		t.Fatal("no token was generated")
+	}
+	if got := a.GetAPISettings(); got != s {
+		t.Errorf("saved settings = %+v, want %+v", got, s)
+	}
+	if code := get(addr, s.Token); code != http.StatusOK {
+		t.Errorf("GET with the token: status %d, want %d", code, http.StatusOK)
+	}
+	if code := get(addr, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("GET with a wrong token: status %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// Only loopback addresses are allowed; the running API is kept.
+	if _, err := a.SetAPISettings(APISettings{Enabled: true, Addr: "0.0.0.0:8470", Token: s.Token}); err == nil {
+		t.Error("listening on every interface was allowed")
+	}
+	if got := a.GetAPISettings(); got != s {
+		t.Errorf("settings after a failed change = %+v, want %+v", got, s)
+	}
+	if code := get(addr, s.Token); code != http.StatusOK {
+		t.Errorf("GET after a failed change: status %d, want %d", code, http.StatusOK)
+	}
+
+	// Moving the API frees the old address.
+	moved := freeAddr(t)
+	if _, err := a.SetAPISettings(APISettings{Enabled: true, Addr: moved, Token: s.Token}); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(addr, s.Token); code != 0 {
+		t.Errorf("old address still answers with %d", code)
+	}
+	if code := get(moved, s.Token); code != http.StatusOK {
+		t.Errorf("GET at the new address: status %d, want %d", code, http.StatusOK)
+	}
+
+	s.Enabled = false
+	if _, err := a.SetAPISettings(s); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(moved, s.Token); code != 0 {
+		t.Errorf("disabled API still answers with %d", code)
+	}
+}
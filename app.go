@@ -2,39 +2,85 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"app/asn"
 	"app/db"
+	"app/export"
+	"app/geoip"
+	"app/pathdiff"
+	"app/scheduler"
 	"app/traceroute"
 )
 
 // App struct
 type App struct {
-	ctx    context.Context
-	mu     sync.Mutex
-	cancel context.CancelFunc
-	db     *db.DB
+	ctx         context.Context
+	mu          sync.Mutex
+	sessions    map[int64]context.CancelFunc // running traces by session ID
+	lastSession int64
+	db          *db.DB
+	sched       *scheduler.Scheduler
+	asn         *asn.Enricher
+	resolver    *traceroute.Resolver // reverse DNS, cached in the db
+	gui         bool                 // started by Wails, so its runtime is available
+	events      eventHub             // events for API clients
+
+	apiMu   sync.Mutex
+	apiStop func() // stops the API the window serves; nil when it is off
+
+	geoMu sync.Mutex
+	geo   *geoip.Reader // nil until a database is found in the data dir
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{}
+	return &App{
+		sessions: map[int64]context.CancelFunc{},
+		resolver: traceroute.NewResolver(nil),
+	}
 }
 
 // startup is called at application startup
 func (a *App) startup(ctx context.Context) {
+	a.gui = true
+	a.open(ctx)
+	if s := a.GetAPISettings(); s.Enabled {
+		if err := a.startAPI(s); err != nil {
+			a.logErrorf("API: %v", err)
+		}
+	}
+}
+
+// open opens the history database and starts the scheduler.  The serve
+// command calls it directly to run the app without a window.
+func (a *App) open(ctx context.Context) {
 	a.ctx = ctx
 	database, err := db.Open()
 	if err != nil {
-		runtime.LogErrorf(ctx, "failed to open database: %v", err)
+		a.logErrorf("failed to open database: %v", err)
 		return
 	}
 	a.db = database
+	a.asn = asn.NewEnricher(database)
+	a.resolver = traceroute.NewResolver(database)
+	a.sched = scheduler.New(database, a.runScheduled, scheduler.DefaultConcurrency, func(err error) {
+		a.logErrorf("scheduler: %v", err)
+	})
+	a.sched.Start(ctx)
 }
 
 // domReady is called after front-end resources have been loaded
@@ -47,94 +93,385 @@ func (a *App) beforeClose(ctx context.Context) (prevent bool) {
 
 // shutdown is called at application termination
 func (a *App) shutdown(ctx context.Context) {
-	a.stopTraceroute()
+	a.stopAPI()
+	a.stopAllTraceroutes()
+	if a.sched != nil {
+		a.sched.Stop()
+	}
 	if a.db != nil {
 		a.db.Close()
 	}
 }
 
-// StartTraceroute starts a traceroute to the given host.
-// Results are streamed to the frontend via "hop" events.
-// Any previous traceroute is cancelled first.
-func (a *App) StartTraceroute(host string, maxHops int, timeoutMs int) {
-	a.mu.Lock()
-	if a.cancel != nil {
-		a.cancel()
-	}
+// StartTraceroute starts a traceroute to the given host and returns the ID
+// of its session.  Results are streamed to the frontend via "hop" events
+// carrying that ID, so several traces can run side by side.
+func (a *App) StartTraceroute(host string, opts traceroute.Options) int64 {
 	ctx, cancel := context.WithCancel(a.ctx)
-	a.cancel = cancel
+	a.mu.Lock()
+	a.lastSession++
+	session := a.lastSession
+	a.sessions[session] = cancel
 	a.mu.Unlock()
 
-	opts := &traceroute.Options{
-		MaxHops:   maxHops,
-		TimeoutMs: timeoutMs,
-	}
-
-	hopChan := make(chan traceroute.Hop, 64)
-	// errChan carries the Run result into the drain goroutine so saving and
-	// terminal event emission happen only after collected is fully populated.
-	errChan := make(chan error, 1)
+	opts.Enrichers = a.enrichers()
+	opts.Resolver = a.resolver
 
-	// Drain goroutine: streams hops to frontend, saves to DB, then fires the
-	// terminal event. This is the single owner of `collected` — no race.
+	// Streams hops to the frontend, saves to DB, then fires the terminal
+	// event.  runTrace returns only once every hop has been emitted.
 	go func() {
-		var collected []traceroute.Hop
-		for hop := range hopChan {
-			collected = append(collected, hop)
-			runtime.EventsEmit(a.ctx, "hop", hop)
-		}
-
-		// hopChan is closed; collected is now complete. Save before notifying UI.
-		runErr := <-errChan
+		defer a.endSession(session)
+		collected, runErr := runTrace(ctx, host, &opts, func(hop traceroute.Hop) {
+			a.emit(session, "hop", HopEvent{SessionID: session, Hop: hop})
+		}, func(ttl int, ip, hostname string) {
+			a.emit(session, "hop:hostname", HostnameEvent{SessionID: session, TTL: ttl, IP: ip, Hostname: hostname})
+		})
 
 		if a.db != nil && len(collected) > 0 {
-			dbHops := make([]db.HopRecord, len(collected))
-			for i, h := range collected {
-				dbHops[i] = db.HopRecord{
-					TTL:      h.TTL,
-					IP:       h.IP,
-					Hostname: h.Hostname,
-					RTT:      h.RTT,
-					Success:  h.Success,
-					IsFinal:  h.IsFinal,
-				}
-			}
-			if id, saveErr := a.db.SaveTrace(host, dbHops); saveErr != nil {
-				runtime.LogErrorf(a.ctx, "failed to save trace: %v", saveErr)
+			run := traceRun(ctx, host, &opts, collected, runErr)
+			if id, saveErr := a.db.SaveTrace(host, run, hopRecords(collected)); saveErr != nil {
+				a.logErrorf("failed to save trace: %v", saveErr)
 			} else {
-				runtime.EventsEmit(a.ctx, "traceroute:saved", id)
+				// Imports and schedules save traces too; the session is
+				// passed alongside so the frontend can tell them apart.
+				a.emit(session, "traceroute:saved", id, session)
+				if completePath(run) {
+					a.notifyPathChange(id, session)
+				}
 			}
 		}
 
 		switch runErr {
 		case traceroute.ErrMaxHopsReached:
-			runtime.EventsEmit(a.ctx, "traceroute:maxhops", maxHops)
+			a.emit(session, "traceroute:maxhops", map[string]any{"sessionId": session, "maxHops": opts.MaxHops})
 		case nil:
-			runtime.EventsEmit(a.ctx, "traceroute:done", nil)
+			a.emit(session, "traceroute:done", session)
 		default:
-			runtime.EventsEmit(a.ctx, "traceroute:error", runErr.Error())
+			a.emit(session, "traceroute:error", map[string]any{"sessionId": session, "error": runErr.Error()})
 		}
 	}()
+	return session
+}
+
+// HopEvent is the payload of a "hop" event: a hop tagged with the session
+// that produced it.
+type HopEvent struct {
+	SessionID int64 `json:"sessionId"`
+	traceroute.Hop
+}
+
+// HostnameEvent is the payload of a "hop:hostname" event, sent when the name
+// of an address already shown in a hop arrives from the resolver.
+type HostnameEvent struct {
+	SessionID int64  `json:"sessionId"`
+	TTL       int    `json:"ttl"`
+	IP        string `json:"ip"`
+	Hostname  string `json:"hostname"`
+}
+
+// enrichers returns the stages that annotate hops before they are emitted.
+func (a *App) enrichers() []traceroute.Enricher {
+	var e []traceroute.Enricher
+	if a.asn != nil {
+		e = append(e, a.asn)
+	}
+	if geo := a.geoIP(); geo != nil {
+		e = append(e, geo)
+	}
+	return e
+}
+
+// geoIP returns the GeoIP database, looking for one in the data dir until
+// the user has supplied it.
+func (a *App) geoIP() *geoip.Reader {
+	a.geoMu.Lock()
+	defer a.geoMu.Unlock()
+	if a.geo == nil {
+		geo, err := openGeoIP()
+		if err != nil {
+			a.logErrorf("GeoIP database: %v", err)
+		}
+		a.geo = geo
+	}
+	return a.geo
+}
+
+// openGeoIP opens the .mmdb file in the data dir, returning nil if there is
+// none.
+func openGeoIP() (*geoip.Reader, error) {
+	dir, err := db.DataDir()
+	if err != nil {
+		return nil, err
+	}
+	path := geoip.Find(dir)
+	if path == "" {
+		return nil, nil
+	}
+	return geoip.Open(path)
+}
+
+// endSession forgets a finished session.
+func (a *App) endSession(session int64) {
+	a.mu.Lock()
+	cancel := a.sessions[session]
+	delete(a.sessions, session)
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// runTrace runs a trace to completion, calling onHop (if non-nil) for every
+// hop as it arrives, and returns the collected hops along with Run's error.
+// Hostnames are looked up in the background: one resolved after its hop was
+// passed to onHop is reported through onName (if non-nil), and one resolved
+// before is simply filled in.  The callbacks are never called concurrently.
+func runTrace(ctx context.Context, host string, opts *traceroute.Options, onHop func(traceroute.Hop), onName func(ttl int, ip, hostname string)) ([]traceroute.Hop, error) {
+	// Continuous mode re-emits each TTL with cumulative statistics, so keep
+	// only the latest hop per TTL; that is the session summary.
+	var mu sync.Mutex
+	latest := map[int]traceroute.Hop{}
+	names := map[string]string{} // by IP
+	opts.OnHostname = func(ttl int, ip, hostname string) {
+		mu.Lock()
+		defer mu.Unlock()
+		names[ip] = hostname
+		if hop, ok := latest[ttl]; ok && setHostname(&hop, ip, hostname) {
+			latest[ttl] = hop
+			if onName != nil {
+				onName(ttl, ip, hostname)
+			}
+		}
+	}
 
-	// Run goroutine: executes the trace, closes hopChan, then sends the error.
+	hopChan := make(chan traceroute.Hop, 64)
+	// errChan carries the Run result back so it is read only after every
+	// hop has been drained.
+	errChan := make(chan error, 1)
 	go func() {
 		err := traceroute.Run(ctx, host, opts, hopChan)
 		close(hopChan)
 		errChan <- err
 	}()
+
+	for hop := range hopChan {
+		mu.Lock()
+		for ip, hostname := range names {
+			setHostname(&hop, ip, hostname)
+		}
+		latest[hop.TTL] = hop
+		if onHop != nil {
+			onHop(hop)
+		}
+		mu.Unlock()
+	}
+	return collectHops(latest), <-errChan
+}
+
+// traceRun describes how a finished run went, for saving with its hops.
+func traceRun(ctx context.Context, host string, opts *traceroute.Options, hops []traceroute.Hop, runErr error) db.TraceRun {
+	run := db.TraceRun{
+		MaxHops:    opts.MaxHops,
+		TimeoutMs:  opts.TimeoutMs,
+		Probes:     opts.Probes,
+		Method:     string(opts.Method),
+		Continuous: opts.Continuous,
+		Status:     db.StatusDone,
+	}
+	switch {
+	case runErr == traceroute.ErrMaxHopsReached:
+		run.Status = db.StatusMaxHops
+	case runErr != nil:
+		run.Status, run.Error = db.StatusError, runErr.Error()
+	case ctx.Err() != nil:
+		run.Status = db.StatusStopped
+	}
+	for _, hop := range hops {
+		if hop.IsFinal {
+			run.DestIP = hop.IP
+		}
+	}
+	if run.DestIP == "" {
+		run.DestIP = traceroute.ResolveDest(host, opts.IPVersion)
+	}
+	return run
+}
+
+// completePath reports whether a saved run covers the whole path, so that it
+// can be compared with the previous one.  Continuous sessions always end by
+// being stopped; a single pass cut short only covers part of the path.
+func completePath(run db.TraceRun) bool {
+	return run.Status == db.StatusDone || run.Status == db.StatusMaxHops ||
+		(run.Continuous && run.Status == db.StatusStopped)
+}
+
+// setHostname names ip wherever it appears unnamed in hop, reporting whether
+// anything changed.
+func setHostname(hop *traceroute.Hop, ip, hostname string) bool {
+	changed := false
+	if hop.IP == ip && hop.Hostname == "" {
+		hop.Hostname, changed = hostname, true
+	}
+	for i := range hop.Responders {
+		if r := &hop.Responders[i]; r.IP == ip && r.Hostname == "" {
+			r.Hostname, changed = hostname, true
+		}
+	}
+	return changed
+}
+
+// notifyPathChange checks a newly saved trace for a path change and tells
+// the frontend about one, along with the session that ran the trace (0 for
+// a scheduled trace).
+func (a *App) notifyPathChange(id, session int64) {
+	if diff, err := checkPathChange(a.db, id); err != nil {
+		a.logErrorf("path change check: %v", err)
+	} else if diff != nil {
+		a.emit(session, "traceroute:pathchanged", diff, session)
+	}
+}
+
+// checkPathChange compares a newly saved trace with the previous trace to the
+// same destination.  If the path differs it records the change and returns
+// the diff; otherwise, or when there is nothing to compare with, it returns
+// nil.
+func checkPathChange(d *db.DB, id int64) (*pathdiff.Diff, error) {
+	prev, err := d.PreviousTrace(id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	diff, err := compareTraces(d, prev.ID, id)
+	if err != nil || !diff.Changed {
+		return nil, err
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.SavePathChange(id, prev.ID, diff.Destination, data); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// compareTraces diffs two stored traces, fromID being the older one.
+func compareTraces(d *db.DB, fromID, toID int64) (pathdiff.Diff, error) {
+	to, err := d.GetTraceRecord(toID)
+	if err != nil {
+		return pathdiff.Diff{}, err
+	}
+	if _, err := d.GetTraceRecord(fromID); err != nil {
+		return pathdiff.Diff{}, err
+	}
+	older, err := d.GetTrace(fromID)
+	if err != nil {
+		return pathdiff.Diff{}, err
+	}
+	newer, err := d.GetTrace(toID)
+	if err != nil {
+		return pathdiff.Diff{}, err
+	}
+	diff := pathdiff.Compare(older, newer)
+	diff.FromID, diff.ToID, diff.Destination = fromID, toID, to.Destination
+	return diff, nil
+}
+
+// collectHops returns the latest hop per TTL in TTL order, dropping rows
+// probed beyond the lowest TTL that turned out to be the destination.
+func collectHops(latest map[int]traceroute.Hop) []traceroute.Hop {
+	finalTTL := 0
+	for ttl, hop := range latest {
+		if hop.IsFinal && (finalTTL == 0 || ttl < finalTTL) {
+			finalTTL = ttl
+		}
+	}
+	collected := make([]traceroute.Hop, 0, len(latest))
+	for ttl, hop := range latest {
+		if finalTTL == 0 || ttl <= finalTTL {
+			collected = append(collected, hop)
+		}
+	}
+	sort.Slice(collected, func(i, j int) bool { return collected[i].TTL < collected[j].TTL })
+	// Boundaries were judged as hops arrived; settle them now all are in.
+	traceroute.MarkASBoundaries(collected)
+	return collected
 }
 
-// StopTraceroute cancels the current traceroute.
-func (a *App) StopTraceroute() {
-	a.stopTraceroute()
+// hopRecords converts traceroute hops into their stored form.
+func hopRecords(hops []traceroute.Hop) []db.HopRecord {
+	recs := make([]db.HopRecord, len(hops))
+	for i, h := range hops {
+		recs[i] = hopRecord(h)
+	}
+	return recs
+}
+
+// hopRecord converts a traceroute hop into its stored form.
+func hopRecord(h traceroute.Hop) db.HopRecord {
+	rec := db.HopRecord{
+		TTL:       h.TTL,
+		IP:        h.IP,
+		Hostname:  h.Hostname,
+		RTT:       h.RTT,
+		Success:   h.Success,
+		IsFinal:   h.IsFinal,
+		Sent:      h.Sent,
+		Received:  h.Received,
+		Loss:      h.Loss,
+		MinRTT:    h.MinRTT,
+		AvgRTT:    h.AvgRTT,
+		MaxRTT:    h.MaxRTT,
+		StdDevRTT: h.StdDevRTT,
+		Jitter:    h.Jitter,
+
+		ASN:        h.ASN,
+		ASName:     h.ASName,
+		ASBoundary: h.ASBoundary,
+
+		CountryCode: h.CountryCode,
+		Country:     h.Country,
+		City:        h.City,
+		Latitude:    h.Latitude,
+		Longitude:   h.Longitude,
+	}
+	for _, r := range h.Responders {
+		rec.Responders = append(rec.Responders, db.ResponderRecord{
+			IP:       r.IP,
+			Hostname: r.Hostname,
+			Count:    r.Count,
+			MinRTT:   r.MinRTT,
+			AvgRTT:   r.AvgRTT,
+			MaxRTT:   r.MaxRTT,
+		})
+	}
+	for _, l := range h.MPLS {
+		rec.MPLS = append(rec.MPLS, db.MPLSLabelRecord{Label: l.Label, TC: l.TC, S: l.S, TTL: l.TTL})
+	}
+	return rec
 }
 
-func (a *App) stopTraceroute() {
+// StopTraceroute cancels the traceroute running in the given session and
+// reports whether there was one.  The session still saves what it collected
+// and sends its terminal event.
+func (a *App) StopTraceroute(session int64) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.cancel != nil {
-		a.cancel()
-		a.cancel = nil
+	cancel := a.sessions[session]
+	if cancel != nil {
+		cancel()
+	}
+	return cancel != nil
+}
+
+// stopAllTraceroutes cancels every running session.
+func (a *App) stopAllTraceroutes() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, cancel := range a.sessions {
+		cancel()
 	}
 }
 
@@ -145,12 +482,22 @@ func (a *App) GetHistory(destination string, limit int) []db.TraceRecord {
 	}
 	records, err := a.db.ListTraces(destination, limit)
 	if err != nil {
-		runtime.LogErrorf(a.ctx, "GetHistory: %v", err)
+		a.logErrorf("GetHistory: %v", err)
 		return nil
 	}
 	return records
 }
 
+// SearchTraces returns one page of the stored traces matching q, most recent
+// first.  Its since and until are RFC3339 times, or null to leave that end
+// of the range open.
+func (a *App) SearchTraces(q db.TraceQuery) (db.SearchResult, error) {
+	if a.db == nil {
+		return db.SearchResult{}, errors.New("history database is not available")
+	}
+	return a.db.SearchTraces(q)
+}
+
 // GetTrace returns the hops for a specific trace ID.
 func (a *App) GetTrace(id int64) []db.HopRecord {
 	if a.db == nil {
@@ -158,20 +505,394 @@ func (a *App) GetTrace(id int64) []db.HopRecord {
 	}
 	hops, err := a.db.GetTrace(id)
 	if err != nil {
-		runtime.LogErrorf(a.ctx, "GetTrace: %v", err)
+		a.logErrorf("GetTrace: %v", err)
 		return nil
 	}
 	return hops
 }
 
-// DeleteTrace removes a trace from history.
-func (a *App) DeleteTrace(id int64) {
+// DeleteTrace removes a trace from history.  It returns db.ErrNotFound if
+// there is no such trace.
+func (a *App) DeleteTrace(id int64) error {
 	if a.db == nil {
-		return
+		return errors.New("history database is not available")
+	}
+	return a.db.DeleteTrace(id)
+}
+
+// DeleteTraces removes every trace to destination (to any destination when
+// it is empty) created in [from, to), given as RFC3339 times; an empty one
+// leaves that end of the range open.  At least one of the three must be
+// given, so that clearing the whole history takes a deliberate range.  It
+// returns how many were removed.
+func (a *App) DeleteTraces(destination, from, to string) (int64, error) {
+	if destination == "" && from == "" && to == "" {
+		return 0, errNoDeleteFilter
+	}
+	if a.db == nil {
+		return 0, errors.New("history database is not available")
+	}
+	since, until, err := parseRange(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return a.db.DeleteTraces(destination, since, until)
+}
+
+// errNoDeleteFilter is returned by DeleteTraces when it is given neither a
+// destination nor either end of a range.
+var errNoDeleteFilter = errors.New("name a destination or a time range to delete")
+
+// parseRange parses the RFC3339 ends of a time range passed from the
+// frontend, where "" leaves that end open.
+func parseRange(from, to string) (since, until time.Time, err error) {
+	if from != "" {
+		if since, err = time.Parse(time.RFC3339, from); err != nil {
+			return
+		}
+	}
+	if to != "" {
+		until, err = time.Parse(time.RFC3339, to)
+	}
+	return
+}
+
+// GetRetentionPolicy returns how much history is kept.
+func (a *App) GetRetentionPolicy() db.RetentionPolicy {
+	if a.db == nil {
+		return db.RetentionPolicy{}
+	}
+	p, err := a.db.RetentionPolicy()
+	if err != nil {
+		a.logErrorf("GetRetentionPolicy: %v", err)
+	}
+	return p
+}
+
+// SetRetentionPolicy changes how much history is kept and applies the new
+// policy at once, returning how many traces it removed.
+func (a *App) SetRetentionPolicy(p db.RetentionPolicy) (int64, error) {
+	if a.db == nil {
+		return 0, errors.New("history database is not available")
+	}
+	return a.db.SetRetentionPolicy(p)
+}
+
+// CompactHistory shrinks the database file by the space deleted traces
+// left behind.
+func (a *App) CompactHistory() error {
+	if a.db == nil {
+		return errors.New("history database is not available")
+	}
+	return a.db.Vacuum()
+}
+
+// ExportTrace asks the user where to save a trace and writes it there in the
+// given format: "json", "csv" or "text".  It returns the chosen path, or ""
+// if the dialog was cancelled.
+func (a *App) ExportTrace(id int64, format string) (string, error) {
+	if a.db == nil {
+		return "", errors.New("history database is not available")
+	}
+	f := export.Format(format)
+	if !slices.Contains(export.Formats, f) {
+		return "", fmt.Errorf("unknown export format %q", format)
+	}
+	record, err := a.db.GetTraceRecord(id)
+	if err != nil {
+		return "", err
+	}
+	hops, err := a.db.GetTrace(id)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export trace",
+		DefaultFilename: exportFilename(record, f),
+		Filters: []runtime.FileFilter{{
+			DisplayName: strings.ToUpper(string(f)) + " files",
+			Pattern:     "*." + f.Extension(),
+		}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+
+	// Render first, so a failure leaves no truncated file behind.
+	var buf bytes.Buffer
+	if err := export.Write(&buf, f, export.Trace{TraceRecord: record, Hops: hops}); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ImportTrace parses pasted traceroute, tracert or mtr --report output and
+// saves it to history as an imported trace, returning its ID.  source names
+// the host the trace was run on; if empty, the host named in mtr output is
+// used.
+func (a *App) ImportTrace(text, source string) (int64, error) {
+	if a.db == nil {
+		return 0, errors.New("history database is not available")
+	}
+	id, err := importTrace(a.db, strings.NewReader(text), source, a.enrichers())
+	if err != nil {
+		return 0, err
+	}
+	a.emit(0, "traceroute:saved", id)
+	return id, nil
+}
+
+// ImportTraceFile asks the user for a file of traceroute output and imports
+// it like ImportTrace.  It returns 0 if the dialog was cancelled.
+func (a *App) ImportTraceFile(source string) (int64, error) {
+	if a.db == nil {
+		return 0, errors.New("history database is not available")
+	}
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Import traceroute output",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Text files", Pattern: "*.txt;*.log"},
+			{DisplayName: "All files", Pattern: "*"},
+		},
+	})
+	if err != nil || path == "" {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	id, err := importTrace(a.db, f, source, a.enrichers())
+	if err != nil {
+		return 0, err
+	}
+	a.emit(0, "traceroute:saved", id)
+	return id, nil
+}
+
+// importTrace parses traceroute output from r, annotates its hops with
+// enrichers and saves it as an imported trace.
+func importTrace(d *db.DB, r io.Reader, source string, enrichers []traceroute.Enricher) (int64, error) {
+	rep, err := traceroute.ParseReport(r)
+	if err != nil {
+		return 0, err
+	}
+	traceroute.EnrichHops(rep.Hops, enrichers)
+	if source == "" {
+		source = rep.Source
+	}
+	return d.SaveImportedTrace(rep.Destination, source, hopRecords(rep.Hops))
+}
+
+// exportFilename suggests a file name such as
+// "traceroute-example.com-20240102-150405.csv".
+func exportFilename(r db.TraceRecord, f export.Format) string {
+	stamp := r.CreatedAt
+	if t, err := time.Parse(time.RFC3339, r.CreatedAt); err == nil {
+		stamp = t.Local().Format("20060102-150405")
+	}
+	name := strings.Map(func(c rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, c) {
+			return '_'
+		}
+		return c
+	}, r.Destination)
+	return fmt.Sprintf("traceroute-%s-%s.%s", name, stamp, f.Extension())
+}
+
+// ImportASNFile asks the user for an IP-to-ASN dataset (see asn.Parse) and
+// replaces the stored table with it, so that later traces are annotated
+// with the AS of each hop.  It returns the number of ranges loaded, or 0 if
+// the dialog was cancelled.
+func (a *App) ImportASNFile() (int, error) {
+	if a.db == nil {
+		return 0, errors.New("history database is not available")
+	}
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Import IP-to-ASN data",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "IP-to-ASN tables", Pattern: "*.tsv;*.csv;*.txt"},
+			{DisplayName: "All files", Pattern: "*"},
+		},
+	})
+	if err != nil || path == "" {
+		return 0, err
+	}
+	return importASN(a.db, a.asn, path)
+}
+
+// importASN loads the IP-to-ASN dataset at path into d and clears e's cache
+// of the old table.
+func importASN(d *db.DB, e *asn.Enricher, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	ranges, err := asn.Parse(f)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.ReplaceASNRanges(ranges); err != nil {
+		return 0, err
+	}
+	e.Reset()
+	return len(ranges), nil
+}
+
+// CompareTraces returns the hop-by-hop differences between two stored traces,
+// fromID being the older one.
+func (a *App) CompareTraces(fromID, toID int64) (pathdiff.Diff, error) {
+	if a.db == nil {
+		return pathdiff.Diff{}, errors.New("history database is not available")
+	}
+	return compareTraces(a.db, fromID, toID)
+}
+
+// GetPathChanges returns the N most recent recorded path changes for a
+// destination, or for all destinations if it is empty.
+func (a *App) GetPathChanges(destination string, limit int) []db.PathChangeRecord {
+	if a.db == nil {
+		return nil
+	}
+	records, err := a.db.ListPathChanges(destination, limit)
+	if err != nil {
+		a.logErrorf("GetPathChanges: %v", err)
+		return nil
+	}
+	return records
+}
+
+// GetHopSeries returns how each hop on the path to destination performed
+// across the stored traces created in [from, to), aggregated into "minute",
+// "hour" or "day" buckets for charting.  from and to are RFC3339 times; an
+// empty one leaves that end of the range open.
+func (a *App) GetHopSeries(destination, bucket, from, to string) ([]db.HopSeries, error) {
+	if a.db == nil {
+		return nil, errors.New("history database is not available")
+	}
+	since, until, err := parseRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return a.db.HopSeries(destination, bucket, since, until)
+}
+
+// CreateSchedule adds a destination to be traced with opts every
+// intervalMinutes, starting now, and returns the schedule's ID.
+func (a *App) CreateSchedule(destination string, intervalMinutes int, opts traceroute.Options) (int64, error) {
+	if a.db == nil {
+		return 0, errors.New("history database is not available")
+	}
+	destination = strings.TrimSpace(destination)
+	if destination == "" {
+		return 0, errors.New("destination is required")
+	}
+	if intervalMinutes < 1 {
+		return 0, errors.New("interval must be at least one minute")
+	}
+	if opts.Continuous {
+		return 0, errors.New("continuous mode cannot be scheduled")
+	}
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return 0, err
+	}
+	id, err := a.db.CreateSchedule(destination, intervalMinutes, options)
+	if err != nil {
+		return 0, err
 	}
-	if err := a.db.DeleteTrace(id); err != nil {
-		runtime.LogErrorf(a.ctx, "DeleteTrace: %v", err)
+	a.sched.Wake()
+	return id, nil
+}
+
+// ListSchedules returns every schedule with the outcome of its last run.
+func (a *App) ListSchedules() []db.ScheduleRecord {
+	if a.db == nil {
+		return nil
+	}
+	records, err := a.db.ListSchedules()
+	if err != nil {
+		a.logErrorf("ListSchedules: %v", err)
+		return nil
+	}
+	return records
+}
+
+// PauseSchedule stops a schedule from running until it is resumed.  A trace
+// already in progress is allowed to finish.
+func (a *App) PauseSchedule(id int64) error {
+	if a.db == nil {
+		return errors.New("history database is not available")
+	}
+	return a.db.SetSchedulePaused(id, true)
+}
+
+// ResumeSchedule lets a paused schedule run again, straight away if its
+// interval has passed.
+func (a *App) ResumeSchedule(id int64) error {
+	if a.db == nil {
+		return errors.New("history database is not available")
+	}
+	if err := a.db.SetSchedulePaused(id, false); err != nil {
+		return err
+	}
+	a.sched.Wake()
+	return nil
+}
+
+// DeleteSchedule removes a schedule and cancels its trace if one is in
+// progress.  Traces it already recorded stay in history.
+func (a *App) DeleteSchedule(id int64) error {
+	if a.db == nil {
+		return errors.New("history database is not available")
+	}
+	if err := a.db.DeleteSchedule(id); err != nil {
+		return err
+	}
+	a.sched.Wake()
+	return nil
+}
+
+// runScheduled runs and saves one trace for a schedule.  It is the
+// scheduler's RunFunc, so it runs in the background alongside any trace the
+// user started.
+func (a *App) runScheduled(ctx context.Context, s db.ScheduleRecord) (int64, error) {
+	opts := traceroute.DefaultOptions()
+	if len(s.Options) > 0 {
+		if err := json.Unmarshal(s.Options, opts); err != nil {
+			return 0, fmt.Errorf("bad schedule options: %w", err)
+		}
+	}
+	opts.Continuous = false
+	opts.Enrichers = a.enrichers()
+	opts.Resolver = a.resolver
+
+	collected, runErr := runTrace(ctx, s.Destination, opts, nil, nil)
+	var id int64
+	if len(collected) > 0 && ctx.Err() == nil {
+		var err error
+		run := traceRun(ctx, s.Destination, opts, collected, runErr)
+		if id, err = a.db.SaveTrace(s.Destination, run, hopRecords(collected)); err != nil {
+			return 0, err
+		}
+		a.emit(0, "traceroute:saved", id)
+		if completePath(run) {
+			a.notifyPathChange(id, 0)
+		}
+	}
+
+	ran := map[string]any{"scheduleId": s.ID, "traceId": id, "error": ""}
+	if runErr != nil {
+		ran["error"] = runErr.Error()
 	}
+	a.emit(0, "schedule:ran", ran)
+	return id, runErr
 }
 
 // GetHostSuggestions returns hostnames from /etc/hosts (excluding loopback entries)
@@ -0,0 +1,199 @@
+// Package asn annotates hops with the autonomous system that announces their
+// address, using an IP-to-ASN table imported into the history database so
+// that lookups work offline.
+package asn
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"app/db"
+	"app/traceroute"
+)
+
+// ErrNoRanges is returned by Parse when the input contains no usable rows.
+var ErrNoRanges = errors.New("no IP-to-ASN ranges found")
+
+// Parse reads an IP-to-ASN dataset.  Each line is one of
+//
+//	1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET   (iptoasn.com TSV)
+//	1.0.0.0/24,13335,"Cloudflare, Inc."            (CIDR CSV, e.g. GeoLite2-ASN)
+//	1.0.0.0	24	13335                           (CAIDA pfx2as)
+//
+// separated by tabs, commas or spaces.  Header and comment lines are
+// skipped, as are ranges with no AS ("Not routed").  Where a prefix has
+// several origins, the first is used.
+func Parse(r io.Reader) ([]db.ASNRange, error) {
+	var ranges []db.ASNRange
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rng, ok := parseLine(line); ok {
+			ranges = append(ranges, rng)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, ErrNoRanges
+	}
+	return ranges, nil
+}
+
+func parseLine(line string) (db.ASNRange, bool) {
+	var fields []string
+	switch {
+	case strings.Contains(line, "\t"):
+		fields = strings.Split(line, "\t")
+	case strings.Contains(line, ","):
+		var err error
+		if fields, err = csv.NewReader(strings.NewReader(line)).Read(); err != nil {
+			return db.ASNRange{}, false
+		}
+	default:
+		fields = strings.Fields(line)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 2 {
+		return db.ASNRange{}, false
+	}
+
+	var rng db.ASNRange
+	var rest []string // ASN, then optional columns
+	if _, network, err := net.ParseCIDR(fields[0]); err == nil {
+		rng.Start, rng.End = network.IP, lastAddr(network)
+		rest = fields[1:]
+	} else if start := net.ParseIP(fields[0]); start != nil && len(fields) >= 3 {
+		if end := net.ParseIP(fields[1]); end != nil {
+			rng.Start, rng.End = start, end
+		} else if bits, err := strconv.Atoi(fields[1]); err == nil {
+			_, network, err := net.ParseCIDR(fields[0] + "/" + strconv.Itoa(bits))
+			if err != nil {
+				return db.ASNRange{}, false
+			}
+			rng.Start, rng.End = network.IP, lastAddr(network)
+		} else {
+			return db.ASNRange{}, false
+		}
+		rest = fields[2:]
+	} else {
+		return db.ASNRange{}, false
+	}
+
+	rng.ASN = parseASN(rest[0])
+	if rng.ASN == 0 {
+		return db.ASNRange{}, false
+	}
+	switch len(rest) {
+	case 1:
+	case 2, 3:
+		rng.Name = rest[len(rest)-1] // iptoasn puts the country first
+	default:
+		rng.Name = strings.Join(rest[2:], " ")
+	}
+	return rng, true
+}
+
+// parseASN reads "13335", "AS13335" or the first of "13335_1234" or
+// "13335,1234" (multi-origin prefixes and AS sets), returning 0 otherwise.
+func parseASN(s string) int {
+	s = strings.TrimPrefix(strings.ToUpper(s), "AS")
+	if i := strings.IndexAny(s, "_,{}"); i >= 0 {
+		s = s[:i]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// lastAddr returns the last address in network.
+func lastAddr(network *net.IPNet) net.IP {
+	ip := network.IP.To16()
+	if v4 := network.IP.To4(); v4 != nil {
+		ip = v4
+	}
+	end := new(big.Int).SetBytes(ip)
+	ones, bits := network.Mask.Size()
+	host := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	end.Add(end, host.Sub(host, big.NewInt(1)))
+	out := make(net.IP, len(ip))
+	end.FillBytes(out)
+	return out
+}
+
+// maxCached bounds the lookup cache; it is simply cleared when full.
+const maxCached = 4096
+
+type entry struct {
+	asn  int
+	name string
+}
+
+// Enricher is a traceroute.Enricher that fills in Hop.ASN and Hop.ASName
+// from the table in the history database.  Results are cached, so call Reset
+// after importing a new table.
+type Enricher struct {
+	db *db.DB
+
+	mu    sync.Mutex
+	cache map[string]entry
+}
+
+var _ traceroute.Enricher = (*Enricher)(nil)
+
+// NewEnricher returns an Enricher reading the table stored in d.
+func NewEnricher(d *db.DB) *Enricher {
+	return &Enricher{db: d, cache: map[string]entry{}}
+}
+
+// Enrich sets the AS of hop's address, unless it already has one (as hops
+// imported from mtr -z output do).  Private and other non-global addresses
+// are never announced and are not looked up.
+func (e *Enricher) Enrich(hop *traceroute.Hop) {
+	ip := net.ParseIP(hop.IP)
+	if hop.ASN != 0 || ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return
+	}
+
+	e.mu.Lock()
+	ent, ok := e.cache[hop.IP]
+	e.mu.Unlock()
+	if !ok {
+		asn, name, err := e.db.LookupASN(ip)
+		if err != nil {
+			return // try again next time
+		}
+		ent = entry{asn, name}
+		e.mu.Lock()
+		if len(e.cache) >= maxCached {
+			clear(e.cache)
+		}
+		e.cache[hop.IP] = ent
+		e.mu.Unlock()
+	}
+	if ent.asn != 0 {
+		hop.ASN, hop.ASName = ent.asn, ent.name
+	}
+}
+
+// Reset forgets cached lookups.
+func (e *Enricher) Reset() {
+	e.mu.Lock()
+	clear(e.cache)
+	e.mu.Unlock()
+}
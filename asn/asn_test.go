@@ -0,0 +1,123 @@
+package asn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wantRange is a parsed range with its addresses as strings.
+type wantRange struct {
+	start, end string
+	asn        int
+	name       string
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file   string
+		ranges []wantRange
+	}{
+		{
+			// CAIDA Routeviews prefix-to-AS, with a multi-origin prefix, an
+			// AS set and an unannounced prefix.
+			file: "routeviews-rv2.pfx2as",
+			ranges: []wantRange{
+				{"1.0.0.0", "1.0.0.255", 13335, ""},
+				{"1.0.4.0", "1.0.7.255", 38803, ""},
+				{"1.0.64.0", "1.0.127.255", 18144, ""},
+				{"1.0.128.0", "1.0.255.255", 23969, ""},
+				{"1.6.4.0", "1.6.4.255", 9583, ""},
+				{"1.9.21.0", "1.9.21.255", 4788, ""},
+				{"2001:200::", "2001:200:ffff:ffff:ffff:ffff:ffff:ffff", 2500, ""},
+			},
+		},
+		{
+			file: "ip2asn-combined.tsv",
+			ranges: []wantRange{
+				{"1.0.0.0", "1.0.0.255", 13335, "CLOUDFLARENET"},
+				{"1.0.4.0", "1.0.7.255", 38803, "WPL-AS-AP Wirefreebroadband Pty Ltd"},
+				{"2001:200::", "2001:200:ffff:ffff:ffff:ffff:ffff:ffff", 2500, "WIDE-BLOCK WIDE Project"},
+			},
+		},
+		{
+			file: "GeoLite2-ASN-Blocks.csv",
+			ranges: []wantRange{
+				{"1.0.0.0", "1.0.0.255", 13335, "CLOUDFLARENET"},
+				{"1.0.4.0", "1.0.7.255", 38803, "Wirefreebroadband Pty Ltd"},
+				{"1.0.64.0", "1.0.127.255", 18144, "Enecom,Inc."},
+				{"2001:200::", "2001:200:ffff:ffff:ffff:ffff:ffff:ffff", 2500, "WIDE Project"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			ranges, err := Parse(f)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(ranges) != len(tt.ranges) {
+				t.Fatalf("got %d ranges, want %d", len(ranges), len(tt.ranges))
+			}
+			for i, want := range tt.ranges {
+				r := ranges[i]
+				got := wantRange{r.Start.String(), r.End.String(), r.ASN, r.Name}
+				if got != want {
+					t.Errorf("range %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want wantRange
+		ok   bool
+	}{
+		{"1.0.0.0 1.0.0.255 13335 US CLOUDFLARENET", wantRange{"1.0.0.0", "1.0.0.255", 13335, "CLOUDFLARENET"}, true},
+		{"1.0.0.0 24 AS13335", wantRange{"1.0.0.0", "1.0.0.255", 13335, ""}, true},
+		{"10.0.0.0/8 64512", wantRange{"10.0.0.0", "10.255.255.255", 64512, ""}, true},
+		{"1.0.0.0\t24\t{13335}", wantRange{}, false},
+		{"1.0.0.0\t33\t13335", wantRange{}, false},
+		{"1.0.0.0\tUS\t13335", wantRange{}, false},
+		{"example.com 13335", wantRange{}, false},
+		{"1.0.0.0/24", wantRange{}, false},
+	}
+	for _, tt := range tests {
+		r, ok := parseLine(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseLine(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		got := wantRange{r.Start.String(), r.End.String(), r.ASN, r.Name}
+		if got != tt.want {
+			t.Errorf("parseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseNoRanges(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"# comment only\n\n",
+		"network,autonomous_system_number,autonomous_system_organization\n",
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n",
+	} {
+		if _, err := Parse(strings.NewReader(in)); !errors.Is(err, ErrNoRanges) {
+			t.Errorf("Parse(%q) error = %v, want ErrNoRanges", in, err)
+		}
+	}
+}
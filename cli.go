@@ -0,0 +1,713 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"app/asn"
+	"app/db"
+	"app/pathdiff"
+	"app/traceroute"
+)
+
+// cliCommands are the subcommands that run headless instead of opening the
+// GUI.  They share traceroute.Run and the history database with the app, so
+// traces recorded here show up in the GUI's history.
+var cliCommands = map[string]func(args []string) error{
+	"trace":      cliTrace,
+	"history":    cliHistory,
+	"show":       cliShow,
+	"delete":     cliDelete,
+	"import":     cliImport,
+	"import-asn": cliImportASN,
+	"retention":  cliRetention,
+	"search":     cliSearch,
+	"series":     cliSeries,
+	"serve":      cliServe,
+}
+
+// errUsage reports a command line that could not be parsed; the flag
+// package has already printed why.
+var errUsage = errors.New("usage")
+
+const cliUsage = `Usage: traceroute <command> [flags] [args]
+
+Commands:
+  trace <host>      trace the path to host and save it to history
+  history [host]    list recent traces, optionally for one destination
+  search            find traces by destination, hop address or hostname,
+                    date, outcome or RTT
+  series <host>     show how each hop's RTT and loss to host changed over
+                    the saved traces
+  show <id>         print a saved trace
+  delete <id>...    remove traces from history, or those matching -dest,
+                    -since and -until
+  import [file]     save traceroute, tracert or mtr --report output to
+                    history, reading stdin without a file
+  import-asn <file> load an IP-to-ASN table used to label hops with their
+                    autonomous system
+  serve             run traces and answer history queries over a local
+                    HTTP/JSON API, with scheduled traces running too
+  retention         show or set how much history is kept
+
+Run "traceroute <command> -h" for the flags of a command.
+Without a command the desktop app starts.
+`
+
+// runCLI runs the subcommand named by args[0] and returns the process exit
+// status.
+func runCLI(args []string) int {
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stdout, cliUsage)
+		return 0
+	}
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "traceroute: unknown command %q\n\n%s", args[0], cliUsage)
+		return 2
+	}
+	err := cmd(args[1:])
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "traceroute %s: %v\n", args[0], err)
+		return 1
+	}
+}
+
+// isCLICommand reports whether arg selects headless mode.
+func isCLICommand(arg string) bool {
+	_, ok := cliCommands[arg]
+	return ok || arg == "help" || arg == "-h" || arg == "--help"
+}
+
+// newFlagSet returns a flag set for a subcommand with a usage line.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: traceroute %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, mapping failures to errUsage.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int, exact bool) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < nargs || (exact && fs.NArg() != nargs) {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// traceResult is the JSON form of a finished "trace" command.
+type traceResult struct {
+	ID          int64            `json:"id,omitempty"` // 0 when not saved
+	Destination string           `json:"destination"`
+	Status      string           `json:"status"` // done, maxhops, stopped or error
+	Error       string           `json:"error,omitempty"`
+	Hops        []traceroute.Hop `json:"hops"`
+	PathChange  *pathdiff.Diff   `json:"pathChange,omitempty"` // vs the previous trace
+}
+
+func cliTrace(args []string) error {
+	opts := traceroute.DefaultOptions()
+	fs := newFlagSet("trace", "<host>")
+	fs.IntVar(&opts.MaxHops, "m", opts.MaxHops, "maximum number of hops")
+	fs.IntVar(&opts.TimeoutMs, "w", opts.TimeoutMs, "per-probe timeout in milliseconds")
+	fs.IntVar(&opts.Probes, "q", opts.Probes, "probes per hop")
+	v4 := fs.Bool("4", false, "use IPv4")
+	v6 := fs.Bool("6", false, "use IPv6")
+	method := fs.String("M", "", "probe method: icmp, udp, tcp or exec (default auto)")
+	fs.IntVar(&opts.Port, "p", 0, "first UDP destination port, or the TCP port")
+	fs.BoolVar(&opts.Continuous, "c", false, "keep probing until interrupted, like mtr")
+	fs.IntVar(&opts.IntervalMs, "i", traceroute.DefaultIntervalMs, "milliseconds between continuous rounds")
+	fs.BoolVar(&opts.Paris, "paris", false, "keep the flow constant so every hop is on one path")
+	fs.IntVar(&opts.FlowID, "flow", 0, "first Paris flow ID")
+	fs.IntVar(&opts.Flows, "flows", 1, "Paris flows cycled per hop, to find alternate paths")
+	fs.StringVar(&opts.DNSServer, "dns", "", "DNS server for reverse lookups (default the system resolver)")
+	fs.IntVar(&opts.DNSTimeoutMs, "dns-timeout", traceroute.DefaultDNSTimeoutMs, "reverse lookup timeout in milliseconds")
+	asJSON := fs.Bool("json", false, "print the result as JSON instead of a table")
+	noSave := fs.Bool("no-save", false, "do not record the trace in history")
+	if err := parseFlags(fs, args, 1, true); err != nil {
+		return err
+	}
+	switch {
+	case *v4 && *v6:
+		return errors.New("-4 and -6 are mutually exclusive")
+	case *v4:
+		opts.IPVersion = 4
+	case *v6:
+		opts.IPVersion = 6
+	}
+	opts.Method = traceroute.Method(*method)
+	host := fs.Arg(0)
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	opts.Enrichers = cliEnrichers(database)
+	opts.Resolver = traceroute.NewResolver(database)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	live := !*asJSON && isTerminal(os.Stdout)
+	var table liveTable
+	latest := map[int]traceroute.Hop{}
+	hops, runErr := runTrace(ctx, host, opts, func(hop traceroute.Hop) {
+		if live {
+			latest[hop.TTL] = hop
+			table.draw(os.Stdout, host, collectHops(latest))
+		}
+	}, func(ttl int, ip, hostname string) {
+		if hop, ok := latest[ttl]; live && ok && setHostname(&hop, ip, hostname) {
+			latest[ttl] = hop
+			table.draw(os.Stdout, host, collectHops(latest))
+		}
+	})
+
+	run := traceRun(ctx, host, opts, hops, runErr)
+	res := traceResult{Destination: host, Status: run.Status, Error: run.Error, Hops: hops}
+
+	if !*noSave && len(hops) > 0 {
+		var err error
+		if res.ID, err = database.SaveTrace(host, run, hopRecords(hops)); err != nil {
+			return fmt.Errorf("save trace: %w", err)
+		}
+		if completePath(run) {
+			if res.PathChange, err = checkPathChange(database, res.ID); err != nil {
+				return fmt.Errorf("path change check: %w", err)
+			}
+		}
+	}
+
+	if *asJSON {
+		if err := writeJSON(os.Stdout, res); err != nil {
+			return err
+		}
+	} else {
+		if !live {
+			table.draw(os.Stdout, host, hops)
+		}
+		switch res.Status {
+		case db.StatusMaxHops:
+			fmt.Printf("destination not reached within %d hops\n", opts.MaxHops)
+		case db.StatusStopped:
+			fmt.Println("stopped")
+		}
+		if res.ID != 0 {
+			fmt.Printf("saved as trace %d\n", res.ID)
+		}
+		if d := res.PathChange; d != nil {
+			fmt.Printf("path changed since trace %d: %d rerouted, %d added, %d removed\n",
+				d.FromID, d.Rerouted, d.Added, d.Removed)
+		}
+	}
+	if runErr != nil && runErr != traceroute.ErrMaxHopsReached {
+		return runErr
+	}
+	return nil
+}
+
+func cliHistory(args []string) error {
+	fs := newFlagSet("history", "[host]")
+	limit := fs.Int("n", 20, "number of traces to list")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := parseFlags(fs, args, 0, false); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	records, err := database.ListTraces(fs.Arg(0), *limit)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if records == nil {
+			records = []db.TraceRecord{}
+		}
+		return writeJSON(os.Stdout, records)
+	}
+	return writeTraceTable(records)
+}
+
+// writeTraceTable lists trace summaries, one per line.
+func writeTraceTable(records []db.TraceRecord) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDestination\tWhen\tHops\tTimeouts\tRTT\tIP\tStatus")
+	for _, r := range records {
+		status := r.Status
+		if status == "" {
+			status = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			r.ID, r.Destination, r.CreatedAt, r.HopCount, r.TimeoutCount, fmtRTT(r.TotalRTT), ipVersionLabel(r.IPVersion), status)
+	}
+	return tw.Flush()
+}
+
+func cliSearch(args []string) error {
+	var q db.TraceQuery
+	fs := newFlagSet("search", "")
+	fs.StringVar(&q.Destination, "dest", "", "destination containing this text")
+	fs.StringVar(&q.HopIP, "ip", "", "some hop answered from this address")
+	fs.StringVar(&q.Hostname, "host", "", "some hop's hostname contains this text")
+	since := fs.String("since", "", "traced on or after this date (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "traced before this date")
+	reached := fs.Bool("reached", false, "only traces that reached the destination")
+	unreached := fs.Bool("unreached", false, "only traces that did not")
+	fs.Float64Var(&q.MinRTT, "min-rtt", 0, "destination RTT at least this many ms")
+	fs.Float64Var(&q.MaxRTT, "max-rtt", 0, "destination RTT at most this many ms")
+	fs.IntVar(&q.Limit, "n", db.DefaultSearchLimit, "traces per page")
+	page := fs.Int("page", 1, "page of results to show")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := parseFlags(fs, args, 0, true); err != nil {
+		return err
+	}
+	if *reached && *unreached {
+		return errors.New("-reached and -unreached are mutually exclusive")
+	}
+	if *reached || *unreached {
+		q.Reached = reached
+	}
+	var err error
+	if q.Since, err = parseDate(*since); err != nil {
+		return err
+	}
+	if q.Until, err = parseDate(*until); err != nil {
+		return err
+	}
+	q.Offset = (max(*page, 1) - 1) * q.Limit
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	res, err := database.SearchTraces(q)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, res)
+	}
+	if err := writeTraceTable(res.Traces); err != nil {
+		return err
+	}
+	if len(res.Traces) < res.Total {
+		fmt.Printf("%d-%d of %d\n", q.Offset+1, q.Offset+len(res.Traces), res.Total)
+	}
+	return nil
+}
+
+func cliSeries(args []string) error {
+	fs := newFlagSet("series", "<host>")
+	bucket := fs.String("by", db.BucketHour, "aggregate per minute, hour or day")
+	since := fs.String("since", "", "only traces on or after this date (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "only traces before this date")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := parseFlags(fs, args, 1, true); err != nil {
+		return err
+	}
+	from, err := parseDate(*since)
+	if err != nil {
+		return err
+	}
+	to, err := parseDate(*until)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	series, err := database.HopSeries(fs.Arg(0), *bucket, from, to)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, series)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TTL\tAddress\tFrom\tTraces\tLoss\tMin\tAvg\tMax")
+	for _, s := range series {
+		addr := s.IP
+		if addr == "" {
+			addr = "*"
+		} else if s.Hostname != "" {
+			addr = s.Hostname + " (" + s.IP + ")"
+		}
+		for _, p := range s.Points {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+				s.TTL, addr, p.Time, p.Traces, fmtLoss(p.Loss, p.Sent), fmtRTT(p.MinRTT), fmtRTT(p.AvgRTT), fmtRTT(p.MaxRTT))
+		}
+	}
+	return tw.Flush()
+}
+
+func cliServe(args []string) error {
+	fs := newFlagSet("serve", "")
+	addr := fs.String("addr", defaultAPIAddr, "loopback address and port to listen on")
+	token := fs.String("token", os.Getenv("TRACEROUTE_API_TOKEN"), "token clients must send (default $TRACEROUTE_API_TOKEN, or a random one)")
+	if err := parseFlags(fs, args, 0, true); err != nil {
+		return err
+	}
+	if *token == "" {
+		var err error
+		if *token, err = newAPIToken(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "API token: %s\n", *token)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := NewApp()
+	a.open(ctx)
+	defer a.shutdown(ctx)
+	if a.db == nil {
+		return errors.New("history database is not available")
+	}
+	return serveAPI(ctx, a, *addr, *token)
+}
+
+func cliShow(args []string) error {
+	fs := newFlagSet("show", "<id>")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := parseFlags(fs, args, 1, true); err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid trace id %q", fs.Arg(0))
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	hops, err := database.GetTrace(id)
+	if err != nil {
+		return err
+	}
+	if len(hops) == 0 {
+		return fmt.Errorf("trace %d not found", id)
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, hops)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	writeHopHeader(tw)
+	for _, h := range hops {
+		writeHopRow(tw, h)
+	}
+	return tw.Flush()
+}
+
+func cliDelete(args []string) error {
+	fs := newFlagSet("delete", "[<id>...]")
+	dest := fs.String("dest", "", "delete every trace to this destination")
+	since := fs.String("since", "", "delete traces from this date (YYYY-MM-DD or RFC3339) on")
+	until := fs.String("until", "", "delete traces from before this date")
+	vacuum := fs.Bool("vacuum", false, "shrink the database file afterwards")
+	if err := parseFlags(fs, args, 0, false); err != nil {
+		return err
+	}
+	byRange := *dest != "" || *since != "" || *until != ""
+	if byRange == (fs.NArg() > 0) {
+		fs.Usage()
+		return errUsage
+	}
+	ids := make([]int64, fs.NArg())
+	for i, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid trace id %q", arg)
+		}
+		ids[i] = id
+	}
+	from, err := parseDate(*since)
+	if err != nil {
+		return err
+	}
+	to, err := parseDate(*until)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	for _, id := range ids {
+		if err := database.DeleteTrace(id); err != nil {
+			return fmt.Errorf("delete trace %d: %w", id, err)
+		}
+	}
+	if byRange {
+		n, err := database.DeleteTraces(*dest, from, to)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("deleted %d traces\n", n)
+	}
+	if *vacuum {
+		return database.Vacuum()
+	}
+	return nil
+}
+
+// parseDate reads a -since or -until flag: a local date or an RFC3339 time.
+// Empty means no bound.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q: want YYYY-MM-DD or RFC3339", s)
+	}
+	return t, nil
+}
+
+func cliRetention(args []string) error {
+	fs := newFlagSet("retention", "")
+	keep := fs.Int("keep", 0, "traces kept per destination (0 = no limit)")
+	days := fs.Int("days", 0, "delete traces older than this many days (0 = never)")
+	size := fs.Int("size", 0, "cap the database at this many MB (0 = no cap)")
+	if err := parseFlags(fs, args, 0, true); err != nil {
+		return err
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	p, err := database.RetentionPolicy()
+	if err != nil {
+		return err
+	}
+	if fs.NFlag() > 0 {
+		// Only the flags given change the policy.
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "keep":
+				p.MaxTracesPerDestination = *keep
+			case "days":
+				p.MaxAgeDays = *days
+			case "size":
+				p.MaxSizeMB = *size
+			}
+		})
+		n, err := database.SetRetentionPolicy(p)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			if err := database.Vacuum(); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %d traces\n", n)
+		}
+	}
+
+	limit := func(n int, unit string) string {
+		if n == 0 {
+			return "no limit"
+		}
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	fmt.Printf("traces per destination: %s\n", limit(p.MaxTracesPerDestination, "traces"))
+	fmt.Printf("maximum age:            %s\n", limit(p.MaxAgeDays, "days"))
+	fmt.Printf("maximum database size:  %s\n", limit(p.MaxSizeMB, "MB"))
+	return nil
+}
+
+func cliImport(args []string) error {
+	fs := newFlagSet("import", "[file]")
+	source := fs.String("source", "", "host the trace was run on")
+	if err := parseFlags(fs, args, 0, false); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+	in := io.Reader(os.Stdin)
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	id, err := importTrace(database, in, *source, cliEnrichers(database))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported as trace %d\n", id)
+	return nil
+}
+
+func cliImportASN(args []string) error {
+	fs := newFlagSet("import-asn", "<file>")
+	if err := parseFlags(fs, args, 1, true); err != nil {
+		return err
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	n, err := importASN(database, asn.NewEnricher(database), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("loaded %d ranges\n", n)
+	return nil
+}
+
+// cliEnrichers returns the hop enrichers backed by d and the data dir.
+func cliEnrichers(d *db.DB) []traceroute.Enricher {
+	e := []traceroute.Enricher{asn.NewEnricher(d)}
+	geo, err := openGeoIP()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "traceroute: GeoIP database: %v\n", err)
+	} else if geo != nil {
+		e = append(e, geo)
+	}
+	return e
+}
+
+// liveTable redraws the hop table in place as hops arrive.
+type liveTable struct {
+	lines int // lines printed by the previous draw
+}
+
+func (t *liveTable) draw(w io.Writer, host string, hops []traceroute.Hop) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "traceroute to %s\n", host)
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	writeHopHeader(tw)
+	for _, h := range hops {
+		writeHopRow(tw, hopRecord(h))
+	}
+	tw.Flush()
+
+	if t.lines > 0 {
+		// Move back over the previous table and clear it.
+		fmt.Fprintf(w, "\x1b[%dA\x1b[J", t.lines)
+	}
+	io.WriteString(w, b.String())
+	t.lines = strings.Count(b.String(), "\n")
+}
+
+func writeHopHeader(w io.Writer) {
+	fmt.Fprintln(w, "TTL\tHost\tAS\tLoss\tSent\tLast\tAvg\tBest\tWorst\tStDev")
+}
+
+func writeHopRow(w io.Writer, h db.HopRecord) {
+	if !h.Success {
+		fmt.Fprintf(w, "%d\t*\t\t%s\t%d\t\t\t\t\t\n", h.TTL, fmtLoss(h.Loss, h.Sent), h.Sent)
+		return
+	}
+	host := h.IP
+	if h.Hostname != "" && h.Hostname != h.IP {
+		host = fmt.Sprintf("%s (%s)", h.Hostname, h.IP)
+	}
+	fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", h.TTL, host, fmtASN(h.ASN), fmtLoss(h.Loss, h.Sent), h.Sent,
+		fmtRTT(h.RTT), fmtRTT(h.AvgRTT), fmtRTT(h.MinRTT), fmtRTT(h.MaxRTT), fmtRTT(h.StdDevRTT))
+}
+
+func fmtASN(asn int) string {
+	if asn == 0 {
+		return "-"
+	}
+	return "AS" + strconv.Itoa(asn)
+}
+
+func fmtRTT(ms float64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(ms, 'f', 1, 64)
+}
+
+func fmtLoss(loss float64, sent int) string {
+	if sent == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(loss, 'f', 1, 64) + "%"
+}
+
+func ipVersionLabel(v int) string {
+	if v == 0 {
+		return "-"
+	}
+	return "IPv" + strconv.Itoa(v)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// isTerminal reports whether f is a character device, so cursor movement
+// escapes are safe to print.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net"
+	"slices"
+)
+
+// ASNRange is a block of addresses announced by one autonomous system, as
+// loaded from an IP-to-ASN dataset.
+type ASNRange struct {
+	Start net.IP // first address, inclusive
+	End   net.IP // last address, inclusive
+	ASN   int
+	Name  string // AS name or description, "" if the dataset has none
+}
+
+// ReplaceASNRanges replaces the stored IP-to-ASN table with ranges.
+// Overlapping ranges are split first, so the table may hold more rows than
+// ranges has.
+func (d *DB) ReplaceASNRanges(ranges []ASNRange) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := writeASNRanges(tx, flattenASNRanges(ranges)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeASNRanges replaces the rows of asn_ranges with ranges, which must
+// not overlap.
+func writeASNRanges(tx *sql.Tx, ranges []ASNRange) error {
+	if _, err := tx.Exec(`DELETE FROM asn_ranges`); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO asn_ranges (start_ip, end_ip, asn, name) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range ranges {
+		if _, err := stmt.Exec([]byte(r.Start.To16()), []byte(r.End.To16()), r.ASN, r.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenASNRanges splits ranges so that none overlap, each address keeping
+// the AS of the most specific range containing it: the latest-starting one,
+// and of those the shortest.  A nested range thus cuts a hole in the one
+// around it.  Ranges that are not valid addresses, or end before they
+// start, are dropped.
+func flattenASNRanges(ranges []ASNRange) []ASNRange {
+	sorted := make([]ASNRange, 0, len(ranges))
+	for _, r := range ranges {
+		r.Start, r.End = r.Start.To16(), r.End.To16()
+		if r.Start != nil && r.End != nil && bytes.Compare(r.Start, r.End) <= 0 {
+			sorted = append(sorted, r)
+		}
+	}
+	// Outer ranges before the ranges nested in them.
+	slices.SortStableFunc(sorted, func(a, b ASNRange) int {
+		if c := bytes.Compare(a.Start, b.Start); c != 0 {
+			return c
+		}
+		return bytes.Compare(b.End, a.End)
+	})
+
+	var flat []ASNRange
+	var open []ASNRange // ranges around next, innermost last
+	var next net.IP     // first address not yet in flat
+	done := false       // flat reaches the very last address
+	emit := func(r ASNRange, end net.IP) {
+		if done || bytes.Compare(next, end) > 0 {
+			return
+		}
+		flat = append(flat, ASNRange{Start: next, End: end, ASN: r.ASN, Name: r.Name})
+		next, done = addrAfter(end)
+	}
+	for _, r := range sorted {
+		for len(open) > 0 && bytes.Compare(open[len(open)-1].End, r.Start) < 0 {
+			emit(open[len(open)-1], open[len(open)-1].End)
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 && bytes.Compare(next, r.Start) < 0 {
+			emit(open[len(open)-1], addrBefore(r.Start))
+		}
+		next, done = r.Start, false
+		open = append(open, r)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		emit(open[i], open[i].End)
+	}
+	return flat
+}
+
+// addrAfter returns the address following ip, and whether ip was the last
+// address so that it wrapped around.
+func addrAfter(ip net.IP) (net.IP, bool) {
+	next := slices.Clone(ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			return next, false
+		}
+	}
+	return next, true
+}
+
+// addrBefore returns the address preceding ip, which must not be the first.
+func addrBefore(ip net.IP) net.IP {
+	prev := slices.Clone(ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		if prev[i]--; prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
+
+// CountASNRanges returns the number of stored IP-to-ASN ranges.
+func (d *DB) CountASNRanges() (int, error) {
+	var n int
+	err := d.conn.QueryRow(`SELECT COUNT(*) FROM asn_ranges`).Scan(&n)
+	return n, err
+}
+
+// LookupASN returns the autonomous system announcing ip, from the most
+// specific stored range containing it.  It returns 0 if no range does.
+func (d *DB) LookupASN(ip net.IP) (asn int, name string, err error) {
+	key := ip.To16()
+	if key == nil {
+		return 0, "", nil
+	}
+	// Addresses are stored as 16-byte blobs, which SQLite compares
+	// bytewise, i.e. in address order.  The stored ranges do not overlap,
+	// so only the last one starting at or before ip can contain it: one
+	// seek down the start_ip index, however far ip is from a range.
+	err = d.conn.QueryRow(
+		`SELECT asn, name FROM (
+		   SELECT asn, name, end_ip FROM asn_ranges
+		   WHERE start_ip <= ?
+		   ORDER BY start_ip DESC
+		   LIMIT 1
+		 ) WHERE end_ip >= ?`,
+		[]byte(key), []byte(key),
+	).Scan(&asn, &name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", nil
+	}
+	return asn, name, err
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"net"
+	"testing"
+)
+
+// asnRange is an ASNRange with its addresses as strings.
+type asnRange struct {
+	start, end string
+	asn        int
+}
+
+func (r asnRange) parse() ASNRange {
+	return ASNRange{Start: net.ParseIP(r.start), End: net.ParseIP(r.end), ASN: r.asn, Name: "AS-" + r.start}
+}
+
+// testRanges has a gap, nested ranges sharing a start or an end with the
+// range around them, a partial overlap and IPv6 up to the last address.
+var testRanges = []asnRange{
+	{"10.0.0.0", "10.255.255.255", 64500},
+	{"10.1.0.0", "10.1.255.255", 64501},
+	{"10.1.2.0", "10.1.2.255", 64502},
+	{"10.0.0.0", "10.0.0.255", 64503},
+	{"10.255.255.0", "10.255.255.255", 64504},
+	{"192.0.2.0", "192.0.2.127", 64505},
+	{"192.0.2.64", "192.0.2.255", 64506},
+	{"2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", 64507},
+	{"ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 64508},
+	{"ffff:ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 64509},
+}
+
+// lookups are addresses and the AS testRanges should give them, 0 for none.
+var lookups = []struct {
+	ip  string
+	asn int
+}{
+	{"9.255.255.255", 0},
+	{"10.0.0.0", 64503},
+	{"10.0.0.255", 64503},
+	{"10.0.1.0", 64500},
+	{"10.1.0.0", 64501},
+	{"10.1.1.255", 64501},
+	{"10.1.2.0", 64502},
+	{"10.1.2.128", 64502},
+	{"10.1.2.255", 64502},
+	{"10.1.3.0", 64501},
+	{"10.1.255.255", 64501},
+	{"10.2.0.0", 64500},
+	{"10.255.254.255", 64500},
+	{"10.255.255.0", 64504},
+	{"10.255.255.255", 64504},
+	{"11.0.0.0", 0},
+	{"100.64.0.1", 0}, // far into the gap
+	{"192.0.2.0", 64505},
+	{"192.0.2.63", 64505},
+	{"192.0.2.64", 64506}, // the later start wins the overlap
+	{"192.0.2.127", 64506},
+	{"192.0.2.255", 64506},
+	{"192.0.3.0", 0},
+	{"::ffff:10.1.2.3", 64502},
+	{"2001:db7:ffff:ffff:ffff:ffff:ffff:ffff", 0},
+	{"2001:db8::", 64507},
+	{"2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", 64507},
+	{"2001:db9::", 0},
+	{"ffff::1", 64508},
+	{"ffff:fffe:ffff:ffff:ffff:ffff:ffff:ffff", 64508},
+	{"ffff:ffff::", 64509},
+	{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 64509},
+}
+
+func checkLookups(t *testing.T, d *DB) {
+	t.Helper()
+	for _, tt := range lookups {
+		asn, name, err := d.LookupASN(net.ParseIP(tt.ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asn != tt.asn {
+			t.Errorf("LookupASN(%s) = %d, want %d", tt.ip, asn, tt.asn)
+		}
+		if asn != 0 && name == "" {
+			t.Errorf("LookupASN(%s) has no name", tt.ip)
+		}
+	}
+}
+
+func TestLookupASN(t *testing.T) {
+	d := openTestDB(t)
+	if asn, _, err := d.LookupASN(net.ParseIP("10.0.0.1")); err != nil || asn != 0 {
+		t.Errorf("empty table: LookupASN = %d, %v", asn, err)
+	}
+
+	ranges := make([]ASNRange, len(testRanges))
+	for i, r := range testRanges {
+		ranges[i] = r.parse()
+	}
+	// An inverted range and a malformed address are dropped.
+	ranges = append(ranges,
+		ASNRange{Start: net.ParseIP("11.0.0.255"), End: net.ParseIP("11.0.0.0"), ASN: 1},
+		ASNRange{Start: net.IP{1, 2, 3}, End: net.ParseIP("11.0.0.0"), ASN: 1},
+	)
+	if err := d.ReplaceASNRanges(ranges); err != nil {
+		t.Fatal(err)
+	}
+	checkLookups(t, d)
+	if asn, _, err := d.LookupASN(nil); err != nil || asn != 0 {
+		t.Errorf("LookupASN(nil) = %d, %v", asn, err)
+	}
+
+	// The stored ranges do not overlap.
+	rows, err := d.conn.Query(`SELECT start_ip, end_ip FROM asn_ranges ORDER BY start_ip`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var prevEnd net.IP
+	for rows.Next() {
+		var start, end []byte
+		if err := rows.Scan(&start, &end); err != nil {
+			t.Fatal(err)
+		}
+		if prevEnd != nil && string(start) <= string(prevEnd) {
+			t.Errorf("range from %v overlaps the one ending at %v", net.IP(start), prevEnd)
+		}
+		prevEnd = end
+	}
+}
+
+func TestMigrateFlatASNRanges(t *testing.T) {
+	d := openTestDB(t)
+	// An overlapping table as imported before it was flattened, with the
+	// schema from before that migration.
+	for _, r := range testRanges {
+		p := r.parse()
+		if _, err := d.conn.Exec(`INSERT INTO asn_ranges (start_ip, end_ip, asn, name) VALUES (?, ?, ?, ?)`,
+			[]byte(p.Start.To16()), []byte(p.End.To16()), p.ASN, p.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := 0
+	for i, m := range migrations {
+		if m.name == "flat ASN ranges" {
+			before = i
+		}
+	}
+	if _, err := d.conn.Exec(`DELETE FROM schema_version WHERE version > ?`, before); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(d.conn); err != nil {
+		t.Fatal(err)
+	}
+	checkLookups(t, d)
+}
@@ -3,7 +3,10 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"time"
@@ -11,6 +14,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// ErrNotFound is returned when a requested trace or schedule does not exist.
+var ErrNotFound = errors.New("db: not found")
+
 // DB wraps a SQLite connection for trace history.
 type DB struct {
 	conn *sql.DB
@@ -23,30 +29,124 @@ type TraceRecord struct {
 	CreatedAt    string  `json:"createdAt"` // RFC3339
 	HopCount     int     `json:"hopCount"`
 	TimeoutCount int     `json:"timeoutCount"`
-	TotalRTT     float64 `json:"totalRtt"` // last hop RTT ms, 0 if not reached
+	TotalRTT     float64 `json:"totalRtt"`  // last hop RTT ms, 0 if not reached
+	IPVersion    int     `json:"ipVersion"` // 4 or 6, 0 if no hop answered
+	Imported     bool    `json:"imported"`  // parsed from another tool's output
+	Source       string  `json:"source"`    // host an imported trace ran on, if known
+
+	TraceRun
 }
 
+// TraceRun records how a trace was run and how it ended.  It is zero for
+// imported traces and for traces saved before it was recorded.
+type TraceRun struct {
+	MaxHops    int    `json:"maxHops"`
+	TimeoutMs  int    `json:"timeoutMs"`
+	Probes     int    `json:"probes"`
+	Method     string `json:"method"` // traceroute.Method, "" = auto
+	Continuous bool   `json:"continuous"`
+	DestIP     string `json:"destIp"` // the address destination resolved to
+	Status     string `json:"status"` // one of the Status constants, "" if unknown
+	Error      string `json:"error"`  // why a trace with StatusError failed
+}
+
+// How a trace ended.
+const (
+	StatusDone    = "done"    // reached the destination
+	StatusMaxHops = "maxhops" // gave up at the hop limit
+	StatusStopped = "stopped" // cancelled; continuous sessions always end so
+	StatusError   = "error"
+)
+
 // HopRecord mirrors traceroute.Hop but belongs to a stored trace.
 type HopRecord struct {
-	TTL      int     `json:"ttl"`
+	TTL       int     `json:"ttl"`
+	IP        string  `json:"ip"`
+	Hostname  string  `json:"hostname"`
+	RTT       float64 `json:"rtt"`
+	Success   bool    `json:"success"`
+	IsFinal   bool    `json:"isFinal"`
+	Sent      int     `json:"sent"`
+	Received  int     `json:"received"`
+	Loss      float64 `json:"loss"` // percent
+	MinRTT    float64 `json:"minRtt"`
+	AvgRTT    float64 `json:"avgRtt"`
+	MaxRTT    float64 `json:"maxRtt"`
+	StdDevRTT float64 `json:"stdDevRtt"`
+	Jitter    float64 `json:"jitter"`
+
+	Responders []ResponderRecord `json:"responders"`
+
+	ASN        int    `json:"asn"` // 0 if unknown
+	ASName     string `json:"asName"`
+	ASBoundary bool   `json:"asBoundary"` // first hop into a different AS
+
+	CountryCode string  `json:"countryCode"` // "" if unknown
+	Country     string  `json:"country"`
+	City        string  `json:"city"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+
+	MPLS []MPLSLabelRecord `json:"mpls"` // outermost first; empty outside a tunnel
+}
+
+// PathChangeRecord is a stored route change: a trace whose path differed
+// from the previous trace to the same destination.
+type PathChangeRecord struct {
+	ID          int64           `json:"id"`
+	TraceID     int64           `json:"traceId"`
+	PrevTraceID int64           `json:"prevTraceId"`
+	Destination string          `json:"destination"`
+	CreatedAt   string          `json:"createdAt"` // RFC3339
+	Diff        json.RawMessage `json:"diff"`      // pathdiff.Diff
+}
+
+// ScheduleRecord is a destination traced again every IntervalMinutes.
+type ScheduleRecord struct {
+	ID              int64           `json:"id"`
+	Destination     string          `json:"destination"`
+	IntervalMinutes int             `json:"intervalMinutes"`
+	Options         json.RawMessage `json:"options"` // traceroute.Options
+	Paused          bool            `json:"paused"`
+	CreatedAt       string          `json:"createdAt"`   // RFC3339
+	LastRunAt       string          `json:"lastRunAt"`   // RFC3339, "" if never run
+	LastTraceID     int64           `json:"lastTraceId"` // 0 if the last run saved nothing
+	LastError       string          `json:"lastError"`
+}
+
+// ResponderRecord is one of the distinct addresses that answered for a hop.
+type ResponderRecord struct {
 	IP       string  `json:"ip"`
 	Hostname string  `json:"hostname"`
-	RTT      float64 `json:"rtt"`
-	Success  bool    `json:"success"`
-	IsFinal  bool    `json:"isFinal"`
+	Count    int     `json:"count"`
+	MinRTT   float64 `json:"minRtt"`
+	AvgRTT   float64 `json:"avgRtt"`
+	MaxRTT   float64 `json:"maxRtt"`
+}
+
+// MPLSLabelRecord is one entry of the MPLS label stack reported for a hop.
+type MPLSLabelRecord struct {
+	Label int  `json:"label"`
+	TC    int  `json:"tc"`
+	S     bool `json:"s"` // bottom of stack
+	TTL   int  `json:"ttl"`
 }
 
 // Open opens (or creates) the SQLite database at the platform data dir.
 func Open() (*DB, error) {
-	dir, err := dataDir()
+	dir, err := DataDir()
 	if err != nil {
 		return nil, fmt.Errorf("db: cannot find data dir: %w", err)
 	}
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("db: cannot create data dir: %w", err)
 	}
+	return openPath(filepath.Join(dir, "history.db"))
+}
 
-	path := filepath.Join(dir, "history.db")
+// openPath opens (or creates) the database file at path, bringing its
+// schema up to date.
+func openPath(path string) (*DB, error) {
 	conn, err := sql.Open("sqlite", path)
 	if err != nil {
 		return nil, fmt.Errorf("db: cannot open %s: %w", path, err)
@@ -54,9 +154,17 @@ func Open() (*DB, error) {
 
 	conn.SetMaxOpenConns(1) // SQLite is single-writer
 	if err := migrate(conn); err != nil {
+		conn.Close()
 		return nil, err
 	}
-	return &DB{conn: conn}, nil
+	d := &DB{conn: conn}
+	// Enforce the retention policy, giving the space freed back to the file
+	// system while nothing else is using the database.  As after each save,
+	// this is best effort.
+	if n, err := d.Prune(); err == nil && n > 0 {
+		_ = d.Vacuum()
+	}
+	return d, nil
 }
 
 // Close closes the database connection.
@@ -64,12 +172,28 @@ func (d *DB) Close() error {
 	return d.conn.Close()
 }
 
-// SaveTrace writes a complete trace to the database and returns its ID.
-func (d *DB) SaveTrace(destination string, hops []HopRecord) (int64, error) {
+// SaveTrace writes a complete trace to the database, along with how it was
+// run, and returns its ID.
+func (d *DB) SaveTrace(destination string, run TraceRun, hops []HopRecord) (int64, error) {
+	return d.saveTrace(destination, false, "", run, hops)
+}
+
+// SaveImportedTrace is SaveTrace for a trace that was run elsewhere and
+// imported from its text output.  source names the host it ran on and may be
+// empty.
+func (d *DB) SaveImportedTrace(destination, source string, hops []HopRecord) (int64, error) {
+	return d.saveTrace(destination, true, source, TraceRun{}, hops)
+}
+
+func (d *DB) saveTrace(destination string, imported bool, source string, run TraceRun, hops []HopRecord) (int64, error) {
 	hopCount := 0
 	timeoutCount := 0
 	totalRTT := 0.0
+	ipVersion := 0
 	for _, h := range hops {
+		if ipVersion == 0 && h.IP != "" {
+			ipVersion = ipVersionOf(h.IP)
+		}
 		if h.Success {
 			hopCount++
 			if h.IsFinal {
@@ -87,13 +211,25 @@ func (d *DB) SaveTrace(destination string, hops []HopRecord) (int64, error) {
 	defer tx.Rollback()
 
 	res, err := tx.Exec(
-		`INSERT INTO traces (destination, created_at, hop_count, timeout_count, total_rtt)
-		 VALUES (?, ?, ?, ?, ?)`,
+		`INSERT INTO traces (destination, created_at, hop_count, timeout_count, total_rtt, ip_version, imported, source,
+		                     max_hops, timeout_ms, probes, method, continuous, dest_ip, status, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		destination,
 		time.Now().UTC().Format(time.RFC3339),
 		hopCount,
 		timeoutCount,
 		totalRTT,
+		ipVersion,
+		imported,
+		source,
+		run.MaxHops,
+		run.TimeoutMs,
+		run.Probes,
+		run.Method,
+		run.Continuous,
+		run.DestIP,
+		run.Status,
+		run.Error,
 	)
 	if err != nil {
 		return 0, err
@@ -104,21 +240,77 @@ func (d *DB) SaveTrace(destination string, hops []HopRecord) (int64, error) {
 	}
 
 	stmt, err := tx.Prepare(
-		`INSERT INTO hops (trace_id, ttl, ip, hostname, rtt, success, is_final)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO hops (trace_id, ttl, ip, hostname, rtt, success, is_final,
+		                   sent, received, loss, min_rtt, avg_rtt, max_rtt, stddev_rtt, jitter,
+		                   asn, as_name, as_boundary, country_code, country, city, latitude, longitude)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 	)
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
+	respStmt, err := tx.Prepare(
+		`INSERT INTO hop_responders (hop_id, ip, hostname, count, min_rtt, avg_rtt, max_rtt)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer respStmt.Close()
+
+	mplsStmt, err := tx.Prepare(
+		`INSERT INTO hop_mpls (hop_id, label, tc, s, ttl) VALUES (?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer mplsStmt.Close()
+
 	for _, h := range hops {
-		if _, err := stmt.Exec(traceID, h.TTL, h.IP, h.Hostname, h.RTT, h.Success, h.IsFinal); err != nil {
+		res, err := stmt.Exec(traceID, h.TTL, h.IP, h.Hostname, h.RTT, h.Success, h.IsFinal,
+			h.Sent, h.Received, h.Loss, h.MinRTT, h.AvgRTT, h.MaxRTT, h.StdDevRTT, h.Jitter,
+			h.ASN, h.ASName, h.ASBoundary, h.CountryCode, h.Country, h.City, h.Latitude, h.Longitude)
+		if err != nil {
+			return 0, err
+		}
+		if len(h.Responders) == 0 && len(h.MPLS) == 0 {
+			continue
+		}
+		hopID, err := res.LastInsertId()
+		if err != nil {
 			return 0, err
 		}
+		for _, r := range h.Responders {
+			if _, err := respStmt.Exec(hopID, r.IP, r.Hostname, r.Count, r.MinRTT, r.AvgRTT, r.MaxRTT); err != nil {
+				return 0, err
+			}
+		}
+		for _, l := range h.MPLS {
+			if _, err := mplsStmt.Exec(hopID, l.Label, l.TC, l.S, l.TTL); err != nil {
+				return 0, err
+			}
+		}
 	}
 
-	return traceID, tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	// The trace is saved either way; a failed prune is retried next time.
+	_, _ = d.Prune()
+	return traceID, nil
+}
+
+// traceColumns are the traces columns read into a TraceRecord by scanTrace.
+const traceColumns = `id, destination, created_at, hop_count, timeout_count, total_rtt, ip_version, imported, source,
+	max_hops, timeout_ms, probes, method, continuous, dest_ip, status, error`
+
+// scanTrace reads a row of traceColumns.
+func scanTrace(row interface{ Scan(...any) error }) (TraceRecord, error) {
+	var r TraceRecord
+	err := row.Scan(&r.ID, &r.Destination, &r.CreatedAt, &r.HopCount, &r.TimeoutCount, &r.TotalRTT, &r.IPVersion, &r.Imported, &r.Source,
+		&r.MaxHops, &r.TimeoutMs, &r.Probes, &r.Method, &r.Continuous, &r.DestIP, &r.Status, &r.Error)
+	return r, err
 }
 
 // ListTraces returns the N most recent traces for a destination.
@@ -130,7 +322,7 @@ func (d *DB) ListTraces(destination string, limit int) ([]TraceRecord, error) {
 	)
 	if destination == "" {
 		rows, err = d.conn.Query(
-			`SELECT id, destination, created_at, hop_count, timeout_count, total_rtt
+			`SELECT `+traceColumns+`
 			 FROM traces
 			 ORDER BY created_at DESC
 			 LIMIT ?`,
@@ -138,7 +330,7 @@ func (d *DB) ListTraces(destination string, limit int) ([]TraceRecord, error) {
 		)
 	} else {
 		rows, err = d.conn.Query(
-			`SELECT id, destination, created_at, hop_count, timeout_count, total_rtt
+			`SELECT `+traceColumns+`
 			 FROM traces
 			 WHERE destination = ?
 			 ORDER BY created_at DESC
@@ -153,8 +345,8 @@ func (d *DB) ListTraces(destination string, limit int) ([]TraceRecord, error) {
 
 	var records []TraceRecord
 	for rows.Next() {
-		var r TraceRecord
-		if err := rows.Scan(&r.ID, &r.Destination, &r.CreatedAt, &r.HopCount, &r.TimeoutCount, &r.TotalRTT); err != nil {
+		r, err := scanTrace(rows)
+		if err != nil {
 			return nil, err
 		}
 		records = append(records, r)
@@ -162,10 +354,22 @@ func (d *DB) ListTraces(destination string, limit int) ([]TraceRecord, error) {
 	return records, rows.Err()
 }
 
+// GetTraceRecord returns the summary row for a specific trace ID, or
+// ErrNotFound.
+func (d *DB) GetTraceRecord(id int64) (TraceRecord, error) {
+	r, err := scanTrace(d.conn.QueryRow(`SELECT `+traceColumns+` FROM traces WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, ErrNotFound
+	}
+	return r, err
+}
+
 // GetTrace returns the hops for a specific trace ID.
 func (d *DB) GetTrace(id int64) ([]HopRecord, error) {
 	rows, err := d.conn.Query(
-		`SELECT ttl, ip, hostname, rtt, success, is_final
+		`SELECT id, ttl, ip, hostname, rtt, success, is_final,
+		        sent, received, loss, min_rtt, avg_rtt, max_rtt, stddev_rtt, jitter,
+		        asn, as_name, as_boundary, country_code, country, city, latitude, longitude
 		 FROM hops WHERE trace_id = ? ORDER BY ttl`,
 		id,
 	)
@@ -175,55 +379,237 @@ func (d *DB) GetTrace(id int64) ([]HopRecord, error) {
 	defer rows.Close()
 
 	var hops []HopRecord
+	byID := map[int64]int{} // hops.id -> index in hops
 	for rows.Next() {
 		var h HopRecord
-		if err := rows.Scan(&h.TTL, &h.IP, &h.Hostname, &h.RTT, &h.Success, &h.IsFinal); err != nil {
+		var hopID int64
+		if err := rows.Scan(&hopID, &h.TTL, &h.IP, &h.Hostname, &h.RTT, &h.Success, &h.IsFinal,
+			&h.Sent, &h.Received, &h.Loss, &h.MinRTT, &h.AvgRTT, &h.MaxRTT, &h.StdDevRTT, &h.Jitter,
+			&h.ASN, &h.ASName, &h.ASBoundary, &h.CountryCode, &h.Country, &h.City, &h.Latitude, &h.Longitude); err != nil {
 			return nil, err
 		}
+		byID[hopID] = len(hops)
 		hops = append(hops, h)
 	}
-	return hops, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	respRows, err := d.conn.Query(
+		`SELECT r.hop_id, r.ip, r.hostname, r.count, r.min_rtt, r.avg_rtt, r.max_rtt
+		 FROM hop_responders r JOIN hops h ON h.id = r.hop_id
+		 WHERE h.trace_id = ? ORDER BY r.hop_id, r.id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer respRows.Close()
+
+	for respRows.Next() {
+		var r ResponderRecord
+		var hopID int64
+		if err := respRows.Scan(&hopID, &r.IP, &r.Hostname, &r.Count, &r.MinRTT, &r.AvgRTT, &r.MaxRTT); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[hopID]; ok {
+			hops[i].Responders = append(hops[i].Responders, r)
+		}
+	}
+	if err := respRows.Err(); err != nil {
+		return nil, err
+	}
+
+	mplsRows, err := d.conn.Query(
+		`SELECT m.hop_id, m.label, m.tc, m.s, m.ttl
+		 FROM hop_mpls m JOIN hops h ON h.id = m.hop_id
+		 WHERE h.trace_id = ? ORDER BY m.hop_id, m.id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer mplsRows.Close()
+
+	for mplsRows.Next() {
+		var l MPLSLabelRecord
+		var hopID int64
+		if err := mplsRows.Scan(&hopID, &l.Label, &l.TC, &l.S, &l.TTL); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[hopID]; ok {
+			hops[i].MPLS = append(hops[i].MPLS, l)
+		}
+	}
+	return hops, mplsRows.Err()
 }
 
-// DeleteTrace removes a trace and its hops.
-func (d *DB) DeleteTrace(id int64) error {
-	_, err := d.conn.Exec(`DELETE FROM traces WHERE id = ?`, id)
+// PreviousTrace returns the most recent trace recorded before id to the same
+// destination over the same IP version, or ErrNotFound.  Imported traces
+// ran elsewhere and are skipped.
+func (d *DB) PreviousTrace(id int64) (TraceRecord, error) {
+	r, err := scanTrace(d.conn.QueryRow(
+		`SELECT `+traceColumns+`
+		 FROM traces WHERE id = (
+		   SELECT p.id
+		   FROM traces t JOIN traces p
+		     ON p.destination = t.destination AND p.ip_version = t.ip_version AND p.id < t.id
+		   WHERE t.id = ? AND p.imported = 0
+		   ORDER BY p.id DESC
+		   LIMIT 1
+		 )`,
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, ErrNotFound
+	}
+	return r, err
+}
+
+// SavePathChange records that trace traceID took a different path than
+// prevTraceID and returns the new row's ID.  diff is the JSON comparison.
+func (d *DB) SavePathChange(traceID, prevTraceID int64, destination string, diff []byte) (int64, error) {
+	res, err := d.conn.Exec(
+		`INSERT INTO path_changes (trace_id, prev_trace_id, destination, created_at, diff)
+		 VALUES (?, ?, ?, ?, ?)`,
+		traceID, prevTraceID, destination, time.Now().UTC().Format(time.RFC3339), string(diff),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListPathChanges returns the N most recent path changes for a destination.
+// If destination is empty, all destinations are returned.
+func (d *DB) ListPathChanges(destination string, limit int) ([]PathChangeRecord, error) {
+	rows, err := d.conn.Query(
+		`SELECT id, trace_id, prev_trace_id, destination, created_at, diff
+		 FROM path_changes
+		 WHERE ? = '' OR destination = ?
+		 ORDER BY id DESC
+		 LIMIT ?`,
+		destination, destination, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PathChangeRecord
+	for rows.Next() {
+		var r PathChangeRecord
+		var diff string
+		if err := rows.Scan(&r.ID, &r.TraceID, &r.PrevTraceID, &r.Destination, &r.CreatedAt, &diff); err != nil {
+			return nil, err
+		}
+		r.Diff = json.RawMessage(diff)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// CreateSchedule stores a new schedule and returns its ID.  options is the
+// JSON encoding of the traceroute.Options to run it with.
+func (d *DB) CreateSchedule(destination string, intervalMinutes int, options []byte) (int64, error) {
+	res, err := d.conn.Exec(
+		`INSERT INTO schedules (destination, interval_minutes, options, created_at)
+		 VALUES (?, ?, ?, ?)`,
+		destination, intervalMinutes, string(options), time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListSchedules returns every schedule, oldest first.
+func (d *DB) ListSchedules() ([]ScheduleRecord, error) {
+	rows, err := d.conn.Query(
+		`SELECT id, destination, interval_minutes, options, paused, created_at,
+		        last_run_at, last_trace_id, last_error
+		 FROM schedules ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []ScheduleRecord
+	for rows.Next() {
+		var r ScheduleRecord
+		var options string
+		if err := rows.Scan(&r.ID, &r.Destination, &r.IntervalMinutes, &options, &r.Paused, &r.CreatedAt,
+			&r.LastRunAt, &r.LastTraceID, &r.LastError); err != nil {
+			return nil, err
+		}
+		r.Options = json.RawMessage(options)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// SetSchedulePaused pauses or resumes a schedule.
+func (d *DB) SetSchedulePaused(id int64, paused bool) error {
+	res, err := d.conn.Exec(`UPDATE schedules SET paused = ? WHERE id = ?`, paused, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordScheduleRun notes that a schedule ran at startedAt, saving trace
+// traceID (0 if none) or failing with runErr (empty on success).
+func (d *DB) RecordScheduleRun(id int64, startedAt time.Time, traceID int64, runErr string) error {
+	_, err := d.conn.Exec(
+		`UPDATE schedules SET last_run_at = ?, last_trace_id = ?, last_error = ? WHERE id = ?`,
+		startedAt.UTC().Format(time.RFC3339), traceID, runErr, id,
+	)
+	return err
+}
+
+// DeleteSchedule removes a schedule.  Traces it recorded are kept.
+func (d *DB) DeleteSchedule(id int64) error {
+	_, err := d.conn.Exec(`DELETE FROM schedules WHERE id = ?`, id)
 	return err
 }
 
+// DeleteTrace removes a trace and its hops.  It returns ErrNotFound if there
+// is no such trace.
+func (d *DB) DeleteTrace(id int64) error {
+	res, err := d.conn.Exec(`DELETE FROM traces WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // --- internal ---
 
-func migrate(conn *sql.DB) error {
-	_, err := conn.Exec(`
-		CREATE TABLE IF NOT EXISTS traces (
-			id           INTEGER PRIMARY KEY AUTOINCREMENT,
-			destination  TEXT    NOT NULL,
-			created_at   TEXT    NOT NULL,
-			hop_count    INTEGER NOT NULL DEFAULT 0,
-			timeout_count INTEGER NOT NULL DEFAULT 0,
-			total_rtt    REAL    NOT NULL DEFAULT 0
-		);
-		CREATE INDEX IF NOT EXISTS idx_traces_dest ON traces(destination, created_at DESC);
-
-		CREATE TABLE IF NOT EXISTS hops (
-			id        INTEGER PRIMARY KEY AUTOINCREMENT,
-			trace_id  INTEGER NOT NULL REFERENCES traces(id) ON DELETE CASCADE,
-			ttl       INTEGER NOT NULL,
-			ip        TEXT    NOT NULL DEFAULT '',
-			hostname  TEXT    NOT NULL DEFAULT '',
-			rtt       REAL    NOT NULL DEFAULT 0,
-			success   INTEGER NOT NULL DEFAULT 0,
-			is_final  INTEGER NOT NULL DEFAULT 0
-		);
-		CREATE INDEX IF NOT EXISTS idx_hops_trace ON hops(trace_id);
-
-		PRAGMA foreign_keys = ON;
-		PRAGMA journal_mode = WAL;
-	`)
-	return err
+// ipVersionOf returns 4 or 6 for an address stored in hops.ip.  Addresses are
+// stored as text in the form net.IP.String produces, so both families share
+// the column.
+func ipVersionOf(ip string) int {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return 0
+	case parsed.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
 }
 
-func dataDir() (string, error) {
+// DataDir returns the directory holding history.db and other per-user data
+// files.  It may not exist yet.
+func DataDir() (string, error) {
 	// macOS: ~/Library/Application Support/traceroute
 	// Linux: ~/.local/share/traceroute
 	// Windows: %APPDATA%\traceroute
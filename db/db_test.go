@@ -0,0 +1,62 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a new database in a temporary directory.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	d, err := openPath(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// count returns the number of rows in table.
+func count(t *testing.T, d *DB, table string) int {
+	t.Helper()
+	var n int
+	if err := d.conn.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// saveAt saves a trace to destination with hops and backdates it to
+// createdAt, returning its ID.
+func saveAt(t *testing.T, d *DB, destination string, createdAt time.Time, hops ...HopRecord) int64 {
+	t.Helper()
+	id, err := d.SaveTrace(destination, TraceRun{Status: StatusDone}, hops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.conn.Exec(`UPDATE traces SET created_at = ? WHERE id = ?`,
+		createdAt.UTC().Format(time.RFC3339), id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// ids returns the IDs of every trace, oldest first.
+func ids(t *testing.T, d *DB) []int64 {
+	t.Helper()
+	rows, err := d.conn.Query(`SELECT id FROM traces ORDER BY created_at, id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
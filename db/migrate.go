@@ -0,0 +1,345 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrNewerSchema is returned by Open when the database was last written by a
+// newer version of the app, whose schema this one does not know.
+var ErrNewerSchema = errors.New("db: database schema is newer than this version supports")
+
+// migrations upgrade the schema one version at a time: migrations[i] takes
+// it from version i to i+1.  Each runs in its own transaction, committed
+// together with the new version number in schema_version.  Entries are only
+// ever appended; once released, a migration must not change.
+var migrations = []struct {
+	name string
+	up   func(tx *sql.Tx) error
+}{
+	{"baseline", migrateBaseline},
+	{"settings", migrateSettings},
+	{"hostname search", migrateHostnameSearch},
+	{"flat ASN ranges", migrateFlatASNRanges},
+}
+
+// migrate brings the schema up to date, creating it in a new database.
+func migrate(conn *sql.DB) error {
+	// Neither setting can change inside a transaction.
+	if _, err := conn.Exec(`PRAGMA foreign_keys = ON; PRAGMA journal_mode = WAL;`); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version    INTEGER PRIMARY KEY,
+			applied_at TEXT    NOT NULL -- RFC3339
+		)`); err != nil {
+		return err
+	}
+
+	version, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%w (version %d, this build knows up to %d)", ErrNewerSchema, version, len(migrations))
+	}
+	for v := version; v < len(migrations); v++ {
+		if err := applyMigration(conn, v+1); err != nil {
+			return fmt.Errorf("db: migrate to version %d (%s): %w", v+1, migrations[v].name, err)
+		}
+	}
+	return nil
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// schemaVersion returns the version recorded in schema_version, 0 for a new
+// database or one created before versioning.
+func schemaVersion(q queryer) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// applyMigration runs the migration to version in a transaction.  Another
+// process opening the database at the same time may have got there first,
+// so the version is checked again inside it.
+func applyMigration(conn *sql.DB, version int) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx)
+	if err != nil || current >= version {
+		return err
+	}
+	if err := migrations[version-1].up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO schema_version (version, applied_at) VALUES (?, ?)`,
+		version, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateBaseline creates the schema as it stood when versioning was
+// introduced.  Databases from before then have some of these tables and
+// columns already, so every step only adds what is missing.
+func migrateBaseline(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS traces (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			destination  TEXT    NOT NULL,
+			created_at   TEXT    NOT NULL,
+			hop_count    INTEGER NOT NULL DEFAULT 0,
+			timeout_count INTEGER NOT NULL DEFAULT 0,
+			total_rtt    REAL    NOT NULL DEFAULT 0,
+			ip_version   INTEGER NOT NULL DEFAULT 0,
+			imported     INTEGER NOT NULL DEFAULT 0,
+			source       TEXT    NOT NULL DEFAULT '',
+			max_hops     INTEGER NOT NULL DEFAULT 0,
+			timeout_ms   INTEGER NOT NULL DEFAULT 0,
+			probes       INTEGER NOT NULL DEFAULT 0,
+			method       TEXT    NOT NULL DEFAULT '',
+			continuous   INTEGER NOT NULL DEFAULT 0,
+			dest_ip      TEXT    NOT NULL DEFAULT '',
+			status       TEXT    NOT NULL DEFAULT '', -- '' = unknown (older or imported)
+			error        TEXT    NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_traces_dest ON traces(destination, created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS hops (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			trace_id     INTEGER NOT NULL REFERENCES traces(id) ON DELETE CASCADE,
+			ttl          INTEGER NOT NULL,
+			ip           TEXT    NOT NULL DEFAULT '',
+			hostname     TEXT    NOT NULL DEFAULT '',
+			rtt          REAL    NOT NULL DEFAULT 0,
+			success      INTEGER NOT NULL DEFAULT 0,
+			is_final     INTEGER NOT NULL DEFAULT 0,
+			sent         INTEGER NOT NULL DEFAULT 0,
+			received     INTEGER NOT NULL DEFAULT 0,
+			loss         REAL    NOT NULL DEFAULT 0,
+			min_rtt      REAL    NOT NULL DEFAULT 0,
+			avg_rtt      REAL    NOT NULL DEFAULT 0,
+			max_rtt      REAL    NOT NULL DEFAULT 0,
+			stddev_rtt   REAL    NOT NULL DEFAULT 0,
+			jitter       REAL    NOT NULL DEFAULT 0,
+			asn          INTEGER NOT NULL DEFAULT 0,
+			as_name      TEXT    NOT NULL DEFAULT '',
+			as_boundary  INTEGER NOT NULL DEFAULT 0,
+			country_code TEXT    NOT NULL DEFAULT '',
+			country      TEXT    NOT NULL DEFAULT '',
+			city         TEXT    NOT NULL DEFAULT '',
+			latitude     REAL    NOT NULL DEFAULT 0,
+			longitude    REAL    NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_hops_trace ON hops(trace_id);
+
+		CREATE TABLE IF NOT EXISTS hop_responders (
+			id        INTEGER PRIMARY KEY AUTOINCREMENT,
+			hop_id    INTEGER NOT NULL REFERENCES hops(id) ON DELETE CASCADE,
+			ip        TEXT    NOT NULL,
+			hostname  TEXT    NOT NULL DEFAULT '',
+			count     INTEGER NOT NULL DEFAULT 0,
+			min_rtt   REAL    NOT NULL DEFAULT 0,
+			avg_rtt   REAL    NOT NULL DEFAULT 0,
+			max_rtt   REAL    NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_hop_responders_hop ON hop_responders(hop_id);
+
+		CREATE TABLE IF NOT EXISTS hop_mpls (
+			id        INTEGER PRIMARY KEY AUTOINCREMENT,
+			hop_id    INTEGER NOT NULL REFERENCES hops(id) ON DELETE CASCADE,
+			label     INTEGER NOT NULL,
+			tc        INTEGER NOT NULL DEFAULT 0,
+			s         INTEGER NOT NULL DEFAULT 0,
+			ttl       INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_hop_mpls_hop ON hop_mpls(hop_id);
+
+		CREATE TABLE IF NOT EXISTS path_changes (
+			id            INTEGER PRIMARY KEY AUTOINCREMENT,
+			trace_id      INTEGER NOT NULL REFERENCES traces(id) ON DELETE CASCADE,
+			prev_trace_id INTEGER NOT NULL REFERENCES traces(id) ON DELETE CASCADE,
+			destination   TEXT    NOT NULL,
+			created_at    TEXT    NOT NULL,
+			diff          TEXT    NOT NULL -- pathdiff.Diff as JSON
+		);
+		CREATE INDEX IF NOT EXISTS idx_path_changes_dest ON path_changes(destination, id DESC);
+
+		CREATE TABLE IF NOT EXISTS schedules (
+			id               INTEGER PRIMARY KEY AUTOINCREMENT,
+			destination      TEXT    NOT NULL,
+			interval_minutes INTEGER NOT NULL,
+			options          TEXT    NOT NULL DEFAULT '{}', -- traceroute.Options as JSON
+			paused           INTEGER NOT NULL DEFAULT 0,
+			created_at       TEXT    NOT NULL,
+			last_run_at      TEXT    NOT NULL DEFAULT '',
+			last_trace_id    INTEGER NOT NULL DEFAULT 0,
+			last_error       TEXT    NOT NULL DEFAULT ''
+		);
+
+		CREATE TABLE IF NOT EXISTS asn_ranges (
+			start_ip BLOB    NOT NULL, -- 16-byte form, IPv4 mapped
+			end_ip   BLOB    NOT NULL,
+			asn      INTEGER NOT NULL,
+			name     TEXT    NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_asn_ranges_start ON asn_ranges(start_ip);
+
+		CREATE TABLE IF NOT EXISTS dns_names (
+			ip         TEXT PRIMARY KEY,
+			hostname   TEXT NOT NULL DEFAULT '', -- '' = no PTR record
+			expires_at TEXT NOT NULL             -- RFC3339
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Columns added before versioning.  CREATE TABLE IF NOT EXISTS leaves
+	// existing tables alone, so databases created by older versions get
+	// them here.
+	if err := addMissingColumns(tx, "traces", []column{
+		{"ip_version", "INTEGER NOT NULL DEFAULT 0"},
+		{"imported", "INTEGER NOT NULL DEFAULT 0"},
+		{"source", "TEXT NOT NULL DEFAULT ''"},
+		{"max_hops", "INTEGER NOT NULL DEFAULT 0"},
+		{"timeout_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"probes", "INTEGER NOT NULL DEFAULT 0"},
+		{"method", "TEXT NOT NULL DEFAULT ''"},
+		{"continuous", "INTEGER NOT NULL DEFAULT 0"},
+		{"dest_ip", "TEXT NOT NULL DEFAULT ''"},
+		{"status", "TEXT NOT NULL DEFAULT ''"},
+		{"error", "TEXT NOT NULL DEFAULT ''"},
+	}); err != nil {
+		return err
+	}
+	return addMissingColumns(tx, "hops", []column{
+		{"sent", "INTEGER NOT NULL DEFAULT 0"},
+		{"received", "INTEGER NOT NULL DEFAULT 0"},
+		{"loss", "REAL NOT NULL DEFAULT 0"},
+		{"min_rtt", "REAL NOT NULL DEFAULT 0"},
+		{"avg_rtt", "REAL NOT NULL DEFAULT 0"},
+		{"max_rtt", "REAL NOT NULL DEFAULT 0"},
+		{"stddev_rtt", "REAL NOT NULL DEFAULT 0"},
+		{"jitter", "REAL NOT NULL DEFAULT 0"},
+		{"asn", "INTEGER NOT NULL DEFAULT 0"},
+		{"as_name", "TEXT NOT NULL DEFAULT ''"},
+		{"as_boundary", "INTEGER NOT NULL DEFAULT 0"},
+		{"country_code", "TEXT NOT NULL DEFAULT ''"},
+		{"country", "TEXT NOT NULL DEFAULT ''"},
+		{"city", "TEXT NOT NULL DEFAULT ''"},
+		{"latitude", "REAL NOT NULL DEFAULT 0"},
+		{"longitude", "REAL NOT NULL DEFAULT 0"},
+	})
+}
+
+// migrateSettings adds a key/value table for preferences kept with the
+// history, such as the retention policy.
+func migrateSettings(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE settings (
+			key   TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`)
+	return err
+}
+
+// migrateHostnameSearch adds a full-text index over hop hostnames for
+// SearchTraces, kept in step with hops by triggers.  The trigram tokenizer
+// lets any part of a name match, not just whole labels.
+func migrateHostnameSearch(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE VIRTUAL TABLE hops_fts USING fts5(
+			hostname, content='hops', content_rowid='id', tokenize='trigram'
+		);
+		CREATE TRIGGER hops_fts_insert AFTER INSERT ON hops BEGIN
+			INSERT INTO hops_fts (rowid, hostname) VALUES (new.id, new.hostname);
+		END;
+		CREATE TRIGGER hops_fts_delete AFTER DELETE ON hops BEGIN
+			INSERT INTO hops_fts (hops_fts, rowid, hostname) VALUES ('delete', old.id, old.hostname);
+		END;
+		CREATE TRIGGER hops_fts_update AFTER UPDATE OF hostname ON hops BEGIN
+			INSERT INTO hops_fts (hops_fts, rowid, hostname) VALUES ('delete', old.id, old.hostname);
+			INSERT INTO hops_fts (rowid, hostname) VALUES (new.id, new.hostname);
+		END;
+		INSERT INTO hops_fts (hops_fts) VALUES ('rebuild');
+	`)
+	return err
+}
+
+// migrateFlatASNRanges splits the overlapping ranges of an IP-to-ASN table
+// imported before ReplaceASNRanges did, which LookupASN no longer allows
+// for.
+func migrateFlatASNRanges(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT start_ip, end_ip, asn, name FROM asn_ranges`)
+	if err != nil {
+		return err
+	}
+	var ranges []ASNRange
+	for rows.Next() {
+		var r ASNRange
+		var start, end []byte
+		if err := rows.Scan(&start, &end, &r.ASN, &r.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		r.Start, r.End = net.IP(start), net.IP(end)
+		ranges = append(ranges, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return writeASNRanges(tx, flattenASNRanges(ranges))
+}
+
+// column is a column name and its SQL type/constraint definition.
+type column struct {
+	name string
+	def  string
+}
+
+// addMissingColumns adds each of cols to table unless it already exists.
+func addMissingColumns(tx *sql.Tx, table string, cols []column) error {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range cols {
+		if have[c.name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, c.name, c.def)); err != nil {
+			return fmt.Errorf("db: add column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
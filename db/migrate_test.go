@@ -0,0 +1,189 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// firstSchema is the schema of the first release, before any column was
+// added or the schema was versioned.
+const firstSchema = `
+	CREATE TABLE traces (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		destination  TEXT    NOT NULL,
+		created_at   TEXT    NOT NULL,
+		hop_count    INTEGER NOT NULL DEFAULT 0,
+		timeout_count INTEGER NOT NULL DEFAULT 0,
+		total_rtt    REAL    NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_traces_dest ON traces(destination, created_at DESC);
+
+	CREATE TABLE hops (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		trace_id  INTEGER NOT NULL REFERENCES traces(id) ON DELETE CASCADE,
+		ttl       INTEGER NOT NULL,
+		ip        TEXT    NOT NULL DEFAULT '',
+		hostname  TEXT    NOT NULL DEFAULT '',
+		rtt       REAL    NOT NULL DEFAULT 0,
+		success   INTEGER NOT NULL DEFAULT 0,
+		is_final  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_hops_trace ON hops(trace_id);
+
+	INSERT INTO traces (destination, created_at, hop_count, timeout_count, total_rtt)
+	VALUES ('example.com', '2023-05-06T07:08:09Z', 2, 0, 12.5);
+	INSERT INTO hops (trace_id, ttl, ip, hostname, rtt, success, is_final) VALUES
+		(1, 1, '192.168.1.1', 'gateway.lan', 0.5, 1, 0),
+		(1, 2, '93.184.216.34', 'edge.example.net', 12.5, 1, 1);
+`
+
+// schema describes every table, index and trigger as table name -> sorted
+// column names, or "index" / "trigger" for those.
+func schema(t *testing.T, conn *sql.DB) map[string][]string {
+	t.Helper()
+	rows, err := conn.Query(`SELECT type, name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	s := map[string][]string{}
+	for rows.Next() {
+		var typ, name string
+		if err := rows.Scan(&typ, &name); err != nil {
+			t.Fatal(err)
+		}
+		if typ == "table" {
+			tables = append(tables, name)
+		} else {
+			s[name] = []string{typ}
+		}
+	}
+	rows.Close()
+	for _, table := range tables {
+		cols, err := conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for cols.Next() {
+			var name string
+			if err := cols.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			s[table] = append(s[table], name)
+		}
+		cols.Close()
+		slices.Sort(s[table])
+	}
+	return s
+}
+
+func TestMigrateFirstRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec(firstSchema); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	d, err := openPath(path)
+	if err != nil {
+		t.Fatalf("openPath: %v", err)
+	}
+	defer d.Close()
+	fresh := openTestDB(t)
+
+	// The upgraded schema is the one a new database gets.
+	got, want := schema(t, d.conn), schema(t, fresh.conn)
+	for name, w := range want {
+		if !slices.Equal(got[name], w) {
+			t.Errorf("%s: upgraded %v, new %v", name, got[name], w)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s: only in the upgraded database", name)
+		}
+	}
+	if v, err := schemaVersion(d.conn); err != nil || v != len(migrations) {
+		t.Errorf("schema version %d (%v), want %d", v, err, len(migrations))
+	}
+
+	// The old trace survives, readable with the new columns at their
+	// defaults and its hostnames in the search index.
+	traces, err := d.ListTraces("example.com", 10)
+	if err != nil || len(traces) != 1 {
+		t.Fatalf("ListTraces = %v, %v", traces, err)
+	}
+	if tr := traces[0]; tr.CreatedAt != "2023-05-06T07:08:09Z" || tr.HopCount != 2 || tr.Status != "" || tr.Imported {
+		t.Errorf("old trace = %+v", tr)
+	}
+	hops, err := d.GetTrace(traces[0].ID)
+	if err != nil || len(hops) != 2 || hops[1].Hostname != "edge.example.net" || hops[1].Sent != 0 {
+		t.Errorf("old hops = %+v, %v", hops, err)
+	}
+	res, err := d.SearchTraces(TraceQuery{Hostname: "example.net"})
+	if err != nil || res.Total != 1 {
+		t.Errorf("hostname search = %+v, %v", res, err)
+	}
+
+	// Migrating again changes nothing.
+	before := count(t, d, "schema_version")
+	if err := migrate(d.conn); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	if n := count(t, d, "schema_version"); n != before || n != len(migrations) {
+		t.Errorf("schema_version has %d rows after migrating again, want %d", n, len(migrations))
+	}
+	if again := schema(t, d.conn); !mapsEqual(again, got) {
+		t.Errorf("schema changed on migrating again:\n%v\n%v", again, got)
+	}
+}
+
+func TestMigrateIdempotentSteps(t *testing.T) {
+	// The baseline runs over databases that already have some of what it
+	// adds, so every step must be safe to repeat.
+	d := openTestDB(t)
+	tx, err := d.conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := migrateBaseline(tx); err != nil {
+		t.Errorf("baseline over a current schema: %v", err)
+	}
+	if err := addMissingColumns(tx, "traces", []column{{"destination", "TEXT"}, {"extra", "TEXT NOT NULL DEFAULT ''"}}); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('traces') WHERE name IN ('destination', 'extra')`).Scan(&n); err != nil || n != 2 {
+		t.Errorf("columns after addMissingColumns: %d, %v", n, err)
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	d := openTestDB(t)
+	if _, err := d.conn.Exec(`INSERT INTO schema_version (version, applied_at) VALUES (?, '')`, len(migrations)+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(d.conn); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("migrate = %v, want ErrNewerSchema", err)
+	}
+}
+
+func mapsEqual(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !slices.Equal(v, b[k]) {
+			return false
+		}
+	}
+	return true
+}
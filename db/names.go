@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoadName returns the cached reverse-DNS name of ip and when it expires, or
+// a zero expiry if none is cached.  Together with SaveName it lets a
+// traceroute.Resolver keep its cache across restarts.
+func (d *DB) LoadName(ip string) (name string, expires time.Time, err error) {
+	var at string
+	err = d.conn.QueryRow(`SELECT hostname, expires_at FROM dns_names WHERE ip = ?`, ip).Scan(&name, &at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires, err = time.Parse(time.RFC3339, at)
+	return name, expires, err
+}
+
+// SaveName caches the reverse-DNS name of ip until expires.  An empty name
+// records that ip has none.  Expired entries are dropped as new ones are
+// written.
+func (d *DB) SaveName(ip, name string, expires time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := d.conn.Exec(`DELETE FROM dns_names WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	_, err := d.conn.Exec(
+		`INSERT INTO dns_names (ip, hostname, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT(ip) DO UPDATE SET hostname = excluded.hostname, expires_at = excluded.expires_at`,
+		ip, name, expires.UTC().Format(time.RFC3339),
+	)
+	return err
+}
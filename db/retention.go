@@ -0,0 +1,158 @@
+package db
+
+import "time"
+
+// RetentionPolicy bounds how much history is kept.  Zero fields impose no
+// limit, so the zero policy keeps everything.
+type RetentionPolicy struct {
+	// MaxTracesPerDestination keeps only the most recent traces to each
+	// destination.
+	MaxTracesPerDestination int `json:"maxTracesPerDestination"`
+	// MaxAgeDays deletes traces older than this many days.
+	MaxAgeDays int `json:"maxAgeDays"`
+	// MaxSizeMB deletes the oldest traces while the data in the database
+	// file takes up more than this.  The whole file counts, including an
+	// imported IP-to-ASN table, but the most recent trace is always kept.
+	MaxSizeMB int `json:"maxSizeMb"`
+}
+
+// retentionKey is the settings row holding the policy as JSON.
+const retentionKey = "retention"
+
+// RetentionPolicy returns the stored policy, or the zero policy if none has
+// been set.
+func (d *DB) RetentionPolicy() (RetentionPolicy, error) {
+	var p RetentionPolicy
+	_, err := d.Setting(retentionKey, &p)
+	return p, err
+}
+
+// SetRetentionPolicy stores p and applies it straight away, returning how
+// many traces it removed.
+func (d *DB) SetRetentionPolicy(p RetentionPolicy) (int64, error) {
+	if err := d.SetSetting(retentionKey, p); err != nil {
+		return 0, err
+	}
+	return d.Prune()
+}
+
+// Prune deletes the traces the retention policy no longer keeps and returns
+// how many it removed.  Open and SaveTrace call it, so it only needs calling
+// directly to apply a policy change made elsewhere.
+func (d *DB) Prune() (int64, error) {
+	p, err := d.RetentionPolicy()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	if p.MaxAgeDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -p.MaxAgeDays)
+		n, err := d.DeleteTraces("", time.Time{}, cutoff)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	if p.MaxTracesPerDestination > 0 {
+		res, err := d.conn.Exec(
+			`DELETE FROM traces WHERE id IN (
+			   SELECT id FROM (
+			     SELECT id, ROW_NUMBER() OVER (PARTITION BY destination ORDER BY created_at DESC, id DESC) AS n
+			     FROM traces
+			   ) WHERE n > ?
+			 )`,
+			p.MaxTracesPerDestination,
+		)
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+	if p.MaxSizeMB > 0 {
+		n, err := d.pruneToSize(int64(p.MaxSizeMB) << 20)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// pruneBatch is how many of the oldest traces pruneToSize deletes before
+// measuring again.
+const pruneBatch = 50
+
+// pruneToSize deletes the oldest traces, all but the most recent, until the
+// pages in use fit in limit bytes.  Freed pages stay in the file for reuse
+// until Vacuum.
+func (d *DB) pruneToSize(limit int64) (int64, error) {
+	var deleted int64
+	for {
+		used, err := d.usedBytes()
+		if err != nil || used <= limit {
+			return deleted, err
+		}
+		res, err := d.conn.Exec(
+			`DELETE FROM traces WHERE id IN (
+			   SELECT id FROM traces
+			   WHERE id <> (SELECT MAX(id) FROM traces)
+			   ORDER BY created_at, id
+			   LIMIT ?
+			 )`,
+			pruneBatch,
+		)
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return deleted, nil // only the newest trace is left
+		}
+		deleted += n
+	}
+}
+
+// usedBytes returns the size of the database pages holding data, which is
+// the file size less the free pages awaiting reuse.
+func (d *DB) usedBytes() (int64, error) {
+	var pages, free, size int64
+	err := d.conn.QueryRow(
+		`SELECT p.page_count, f.freelist_count, s.page_size
+		 FROM pragma_page_count() p, pragma_freelist_count() f, pragma_page_size() s`,
+	).Scan(&pages, &free, &size)
+	return (pages - free) * size, err
+}
+
+// DeleteTraces removes every trace to destination (to any destination when
+// it is empty) created in [from, to), and returns how many it removed.  A
+// zero from or to leaves that end of the range open.
+func (d *DB) DeleteTraces(destination string, from, to time.Time) (int64, error) {
+	fromStr, toStr := "", ""
+	if !from.IsZero() {
+		fromStr = from.UTC().Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		toStr = to.UTC().Format(time.RFC3339)
+	}
+	res, err := d.conn.Exec(
+		`DELETE FROM traces
+		 WHERE (? = '' OR destination = ?)
+		   AND (? = '' OR created_at >= ?)
+		   AND (? = '' OR created_at < ?)`,
+		destination, destination, fromStr, fromStr, toStr, toStr,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Vacuum rebuilds the database file so that it shrinks by the space freed by
+// deletions.  It rewrites the whole file, so it is best run when little else
+// is happening.
+func (d *DB) Vacuum() error {
+	_, err := d.conn.Exec(`VACUUM`)
+	return err
+}
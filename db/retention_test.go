@@ -0,0 +1,182 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeleteTraces(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name        string
+		destination string
+		from, to    time.Time
+		left        []int // days of the traces kept
+	}{
+		{"destination", "a.example", time.Time{}, time.Time{}, []int{4, 5, 6}},
+		{"from is included", "", day(2), time.Time{}, []int{1}},
+		{"to is excluded", "", time.Time{}, day(2), []int{2, 3, 4, 5, 6}},
+		{"range", "", day(2), day(3), []int{1, 3, 4, 5, 6}},
+		{"empty range", "", day(2), day(2), []int{1, 2, 3, 4, 5, 6}},
+		{"destination and range", "b.example", day(5), day(7), []int{1, 2, 3, 4}},
+		{"instant before to", "", day(3).Add(-time.Second), day(3), []int{1, 2, 3, 4, 5, 6}},
+	}
+	// a.example is traced on the 1st to 3rd of the month and b.example on
+	// the 4th to 6th, so day(n) is exactly when trace n was made.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := openTestDB(t)
+			byDay := map[int64]int{}
+			for i, dest := range []string{"a.example", "b.example"} {
+				for n := 1; n <= 3; n++ {
+					byDay[saveAt(t, d, dest, day(3*i+n))] = 3*i + n
+				}
+			}
+			n, err := d.DeleteTraces(tt.destination, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []int
+			for _, id := range ids(t, d) {
+				left = append(left, byDay[id])
+			}
+			if !slices.Equal(left, tt.left) {
+				t.Errorf("left %v, want %v", left, tt.left)
+			}
+			if int(n) != 6-len(tt.left) {
+				t.Errorf("reported %d deleted, want %d", n, 6-len(tt.left))
+			}
+		})
+	}
+}
+
+func TestDeleteTraceCascades(t *testing.T) {
+	d := openTestDB(t)
+	hops := []HopRecord{
+		{TTL: 1, IP: "10.0.0.1", Hostname: "gw.example", Success: true,
+			Responders: []ResponderRecord{{IP: "10.0.0.1", Count: 1}, {IP: "10.0.0.2", Count: 1}},
+			MPLS:       []MPLSLabelRecord{{Label: 16, S: true, TTL: 1}}},
+		{TTL: 2},
+	}
+	keep := saveAt(t, d, "kept.example", time.Now(), hops...)
+	id := saveAt(t, d, "deleted.example", time.Now(), hops...)
+	before := map[string]int{}
+	for _, table := range []string{"hops", "hop_responders", "hop_mpls", "hops_fts"} {
+		before[table] = count(t, d, table)
+	}
+
+	if err := d.DeleteTrace(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteTrace(id); err != ErrNotFound {
+		t.Errorf("deleting it again = %v, want ErrNotFound", err)
+	}
+	for table, n := range before {
+		if got := count(t, d, table); got != n/2 {
+			t.Errorf("%s: %d rows left, want %d", table, got, n/2)
+		}
+	}
+	if got, err := d.GetTrace(keep); err != nil || len(got) != 2 || len(got[0].Responders) != 2 {
+		t.Errorf("other trace = %+v, %v", got, err)
+	}
+
+	if _, err := d.DeleteTraces("kept.example", time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	for table := range before {
+		if n := count(t, d, table); n != 0 {
+			t.Errorf("%s: %d rows left after deleting every trace", table, n)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		left   []int64 // trace numbers, 1 the oldest
+	}{
+		{"keep everything", RetentionPolicy{}, []int64{1, 2, 3, 4, 5}},
+		{"per destination", RetentionPolicy{MaxTracesPerDestination: 1}, []int64{4, 5}},
+		{"by age", RetentionPolicy{MaxAgeDays: 7}, []int64{3, 4, 5}},
+		{"both", RetentionPolicy{MaxTracesPerDestination: 2, MaxAgeDays: 5}, []int64{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := openTestDB(t)
+			// Oldest first: a.example 30 and 10 days ago, b.example
+			// 2 days ago, then a.example and b.example today.
+			for i, c := range []struct {
+				dest string
+				age  int
+			}{{"a.example", 30}, {"a.example", 10}, {"b.example", 2}, {"a.example", 0}, {"b.example", 0}} {
+				if id := saveAt(t, d, c.dest, now.AddDate(0, 0, -c.age).Add(time.Duration(i)*time.Second)); id != int64(i+1) {
+					t.Fatalf("trace %d saved as %d", i+1, id)
+				}
+			}
+			n, err := d.SetRetentionPolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if left := ids(t, d); !slices.Equal(left, tt.left) {
+				t.Errorf("left %v, want %v", left, tt.left)
+			}
+			if int(n) != 5-len(tt.left) {
+				t.Errorf("reported %d pruned, want %d", n, 5-len(tt.left))
+			}
+			if p, err := d.RetentionPolicy(); err != nil || p != tt.policy {
+				t.Errorf("stored policy = %+v, %v", p, err)
+			}
+		})
+	}
+}
+
+func TestPruneToSize(t *testing.T) {
+	d := openTestDB(t)
+	hops := make([]HopRecord, 30)
+	for i := range hops {
+		hops[i] = HopRecord{TTL: i + 1, IP: "192.0.2.1", Hostname: "a-fairly-long-router-name.example.net", Success: true}
+	}
+	start := time.Now().Add(-time.Hour)
+	for i := range 2 * pruneBatch {
+		saveAt(t, d, "example.com", start.Add(time.Duration(i)*time.Second), hops...)
+	}
+	newest := ids(t, d)[2*pruneBatch-1]
+
+	// A limit the database already fits in deletes nothing.
+	used, err := d.usedBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.pruneToSize(used); err != nil || n != 0 {
+		t.Errorf("pruneToSize(used) = %d, %v, want nothing deleted", n, err)
+	}
+
+	// Halfway down, the oldest go first.
+	empty, err := openTestDB(t).usedBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := d.pruneToSize(empty + (used-empty)/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := ids(t, d)
+	if n == 0 || len(left) == 0 || int(n)+len(left) != 2*pruneBatch {
+		t.Fatalf("deleted %d, left %d of %d", n, len(left), 2*pruneBatch)
+	}
+	if left[len(left)-1] != newest || left[0] != newest-int64(len(left))+1 {
+		t.Errorf("kept %v, want the newest %d", left, len(left))
+	}
+
+	// No limit is small enough to delete the newest trace.
+	if _, err := d.pruneToSize(1); err != nil {
+		t.Fatal(err)
+	}
+	if left := ids(t, d); !slices.Equal(left, []int64{newest}) {
+		t.Errorf("left %v, want only the newest, %d", left, newest)
+	}
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TraceQuery selects traces for SearchTraces.  Every field left at its zero
+// value matches all traces; the others must all match.
+type TraceQuery struct {
+	Destination string    `json:"destination"` // substring, case-insensitive
+	HopIP       string    `json:"hopIp"`       // an address that answered for any hop
+	Hostname    string    `json:"hostname"`    // substring of any hop's hostname
+	Since       time.Time `json:"since"`       // created at or after
+	Until       time.Time `json:"until"`       // created before
+	Reached     *bool     `json:"reached"`     // whether the destination answered
+	MinRTT      float64   `json:"minRtt"`      // destination RTT at least, ms
+	MaxRTT      float64   `json:"maxRtt"`      // destination RTT at most, ms
+
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"` // DefaultSearchLimit when zero
+}
+
+// DefaultSearchLimit is the page size of a TraceQuery without a Limit.
+const DefaultSearchLimit = 50
+
+// SearchResult is one page of matching traces, most recent first, with the
+// number of matches over all pages.
+type SearchResult struct {
+	Traces []TraceRecord `json:"traces"`
+	Total  int           `json:"total"`
+}
+
+// SearchTraces returns the traces matching q.  Hostnames are matched through
+// a trigram full-text index, so substrings of three or more characters are
+// found without scanning every hop.
+func (d *DB) SearchTraces(q TraceQuery) (SearchResult, error) {
+	var where []string
+	var args []any
+	add := func(cond string, a ...any) {
+		where = append(where, cond)
+		args = append(args, a...)
+	}
+
+	if q.Destination != "" {
+		add(`destination LIKE ? ESCAPE '\'`, "%"+escapeLike(q.Destination)+"%")
+	}
+	if q.HopIP != "" {
+		ip := q.HopIP
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String() // the form hops.ip is stored in
+		}
+		add(`id IN (SELECT trace_id FROM hops WHERE ip = ?
+		           UNION
+		           SELECT h.trace_id FROM hop_responders r JOIN hops h ON h.id = r.hop_id WHERE r.ip = ?)`, ip, ip)
+	}
+	if q.Hostname != "" {
+		if utf8.RuneCountInString(q.Hostname) >= 3 {
+			// A quoted FTS5 string; trigrams match it anywhere in a name.
+			phrase := `"` + strings.ReplaceAll(q.Hostname, `"`, `""`) + `"`
+			add(`id IN (SELECT h.trace_id FROM hops_fts f JOIN hops h ON h.id = f.rowid WHERE hops_fts MATCH ?)`, phrase)
+		} else {
+			// Too short for a trigram.
+			add(`id IN (SELECT trace_id FROM hops WHERE hostname LIKE ? ESCAPE '\')`, "%"+escapeLike(q.Hostname)+"%")
+		}
+	}
+	if !q.Since.IsZero() {
+		add(`created_at >= ?`, q.Since.UTC().Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		add(`created_at < ?`, q.Until.UTC().Format(time.RFC3339))
+	}
+	if q.Reached != nil {
+		cond := `EXISTS (SELECT 1 FROM hops WHERE trace_id = traces.id AND is_final = 1 AND success = 1)`
+		if !*q.Reached {
+			cond = "NOT " + cond
+		}
+		add(cond)
+	}
+	if q.MinRTT > 0 {
+		add(`total_rtt >= ?`, q.MinRTT)
+	}
+	if q.MaxRTT > 0 {
+		add(`total_rtt > 0 AND total_rtt <= ?`, q.MaxRTT)
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var res SearchResult
+	if err := d.conn.QueryRow(`SELECT COUNT(*) FROM traces`+filter, args...).Scan(&res.Total); err != nil {
+		return res, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	rows, err := d.conn.Query(
+		`SELECT `+traceColumns+` FROM traces`+filter+`
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT ? OFFSET ?`,
+		append(args, limit, max(q.Offset, 0))...,
+	)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	res.Traces = []TraceRecord{}
+	for rows.Next() {
+		r, err := scanTrace(rows)
+		if err != nil {
+			return res, err
+		}
+		res.Traces = append(res.Traces, r)
+	}
+	return res, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s, for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
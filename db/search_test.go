@@ -0,0 +1,123 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSearchTraces(t *testing.T) {
+	d := openTestDB(t)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// Each trace is an hour after the one before, so results come back in
+	// the reverse of this order.
+	traces := []struct {
+		destination string
+		hostnames   []string
+	}{
+		{"www.example.com", []string{"gw.lan", "core-1.ams.example.net"}},
+		{"api.example.org", []string{"gw.lan", "edge_2.fra.example.net"}},
+		{"Mail.Example.COM", []string{"ROUTER.LAN", "100%-up.example"}},
+		{"db.internal", []string{"x.y", `say-"hi"*.test`, "(paren) OR AND NOT NEAR.test"}},
+	}
+	id := map[string]int64{}
+	for i, tr := range traces {
+		hops := make([]HopRecord, len(tr.hostnames))
+		for j, name := range tr.hostnames {
+			hops[j] = HopRecord{TTL: j + 1, IP: "192.0.2.1", Hostname: name, Success: true}
+		}
+		id[tr.destination] = saveAt(t, d, tr.destination, start.Add(time.Duration(i)*time.Hour), hops...)
+	}
+
+	tests := []struct {
+		name string
+		q    TraceQuery
+		want []string // destinations, most recent first
+	}{
+		{"everything", TraceQuery{}, []string{"db.internal", "Mail.Example.COM", "api.example.org", "www.example.com"}},
+
+		{"destination substring", TraceQuery{Destination: "example"}, []string{"Mail.Example.COM", "api.example.org", "www.example.com"}},
+		{"destination case", TraceQuery{Destination: "EXAMPLE.com"}, []string{"Mail.Example.COM", "www.example.com"}},
+		{"destination short", TraceQuery{Destination: "b."}, []string{"db.internal"}},
+		{"destination wildcards are literal", TraceQuery{Destination: "w_w"}, nil},
+		{"destination percent", TraceQuery{Destination: "%"}, nil},
+
+		{"hostname substring", TraceQuery{Hostname: "example.net"}, []string{"api.example.org", "www.example.com"}},
+		{"hostname middle", TraceQuery{Hostname: "ams"}, []string{"www.example.com"}},
+		{"hostname case", TraceQuery{Hostname: "router"}, []string{"Mail.Example.COM"}},
+		{"hostname across traces", TraceQuery{Hostname: ".lan"}, []string{"Mail.Example.COM", "api.example.org", "www.example.com"}},
+		{"hostname no match", TraceQuery{Hostname: "example.org"}, nil},
+
+		// Under three characters there are no trigrams to look up.
+		{"hostname two characters", TraceQuery{Hostname: "gw"}, []string{"api.example.org", "www.example.com"}},
+		{"hostname one character", TraceQuery{Hostname: "y"}, []string{"db.internal"}},
+		{"hostname short case", TraceQuery{Hostname: "LA"}, []string{"Mail.Example.COM", "api.example.org", "www.example.com"}},
+		{"hostname short underscore", TraceQuery{Hostname: "_"}, []string{"api.example.org"}},
+		{"hostname short percent", TraceQuery{Hostname: "%"}, []string{"Mail.Example.COM"}},
+
+		// FTS5 syntax is matched as text.
+		{"hostname quotes", TraceQuery{Hostname: `"hi"`}, []string{"db.internal"}},
+		{"hostname star", TraceQuery{Hostname: `"*.t`}, []string{"db.internal"}},
+		{"hostname star alone", TraceQuery{Hostname: `edge*`}, nil},
+		{"hostname minus", TraceQuery{Hostname: "-1.ams"}, []string{"www.example.com"}},
+		{"hostname parenthesis", TraceQuery{Hostname: "(paren"}, []string{"db.internal"}},
+		{"hostname operators", TraceQuery{Hostname: "OR AND NOT NEAR"}, []string{"db.internal"}},
+		{"hostname operator alone", TraceQuery{Hostname: "NOT"}, []string{"db.internal"}},
+		{"hostname colon", TraceQuery{Hostname: "hostname:gw"}, nil},
+		{"hostname percent", TraceQuery{Hostname: "100%"}, []string{"Mail.Example.COM"}},
+		{"hostname underscore", TraceQuery{Hostname: "e_2"}, []string{"api.example.org"}},
+		{"hostname underscore is literal", TraceQuery{Hostname: "e_1"}, nil},
+
+		{"destination and hostname", TraceQuery{Destination: ".com", Hostname: "lan"}, []string{"Mail.Example.COM", "www.example.com"}},
+		{"since and until", TraceQuery{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)}, []string{"Mail.Example.COM", "api.example.org"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := d.SearchTraces(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range res.Traces {
+				got = append(got, r.Destination)
+				if r.ID != id[r.Destination] {
+					t.Errorf("%s has ID %d, want %d", r.Destination, r.ID, id[r.Destination])
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if res.Total != len(tt.want) {
+				t.Errorf("total %d, want %d", res.Total, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSearchTracesPages(t *testing.T) {
+	d := openTestDB(t)
+	start := time.Now().Add(-time.Hour)
+	for i := range 5 {
+		saveAt(t, d, "example.com", start.Add(time.Duration(i)*time.Minute),
+			HopRecord{TTL: 1, IP: "192.0.2.1", Hostname: "gw.example.net", Success: true})
+	}
+	all := ids(t, d)
+	slices.Reverse(all)
+
+	var got []int64
+	for offset := 0; offset < 6; offset += 2 {
+		res, err := d.SearchTraces(TraceQuery{Hostname: "example", Limit: 2, Offset: offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 5 {
+			t.Errorf("offset %d: total %d, want 5", offset, res.Total)
+		}
+		for _, r := range res.Traces {
+			got = append(got, r.ID)
+		}
+	}
+	if !slices.Equal(got, all) {
+		t.Errorf("pages = %v, want %v", got, all)
+	}
+}
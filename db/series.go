@@ -0,0 +1,107 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// The periods HopSeries aggregates over.
+const (
+	BucketMinute = "minute"
+	BucketHour   = "hour"
+	BucketDay    = "day"
+)
+
+// bucketFormats truncate an RFC3339 created_at to the start of its bucket,
+// in UTC.
+var bucketFormats = map[string]string{
+	BucketMinute: "%Y-%m-%dT%H:%M:00Z",
+	BucketHour:   "%Y-%m-%dT%H:00:00Z",
+	BucketDay:    "%Y-%m-%dT00:00:00Z",
+}
+
+// HopSeries is how one hop of the path to a destination performed over
+// time: the traces in which ip answered at ttl, or, with an empty IP, those
+// in which nothing did.
+type HopSeries struct {
+	TTL      int         `json:"ttl"`
+	IP       string      `json:"ip"`       // "" for the timeouts at TTL
+	Hostname string      `json:"hostname"` // as of the latest bucket with one
+	Points   []HopSample `json:"points"`   // oldest first
+}
+
+// HopSample aggregates a hop over the traces in one bucket.
+type HopSample struct {
+	Time     string  `json:"time"` // RFC3339 start of the bucket
+	Traces   int     `json:"traces"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss"`   // percent
+	MinRTT   float64 `json:"minRtt"` // ms; zero when nothing answered
+	AvgRTT   float64 `json:"avgRtt"`
+	MaxRTT   float64 `json:"maxRtt"`
+}
+
+// HopSeries returns the per-hop RTT and loss of the traces to destination
+// created in [from, to), aggregated into buckets, ordered by TTL and then
+// address.  A zero from or to leaves that end of the range open.  Hops
+// stored without probe counts, such as imported ones, count as one probe.
+func (d *DB) HopSeries(destination string, bucket string, from, to time.Time) ([]HopSeries, error) {
+	format, ok := bucketFormats[bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket %q", bucket)
+	}
+	fromStr, toStr := "", ""
+	if !from.IsZero() {
+		fromStr = from.UTC().Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		toStr = to.UTC().Format(time.RFC3339)
+	}
+
+	rows, err := d.conn.Query(
+		`SELECT h.ttl, h.ip, strftime(?, t.created_at) AS bucket,
+		        COUNT(*),
+		        SUM(CASE WHEN h.sent > 0 THEN h.sent ELSE 1 END),
+		        SUM(CASE WHEN h.sent > 0 THEN h.received ELSE h.success END),
+		        COALESCE(MIN(CASE WHEN h.success THEN CASE WHEN h.min_rtt > 0 THEN h.min_rtt ELSE h.rtt END END), 0),
+		        COALESCE(AVG(CASE WHEN h.success THEN CASE WHEN h.avg_rtt > 0 THEN h.avg_rtt ELSE h.rtt END END), 0),
+		        COALESCE(MAX(CASE WHEN h.success THEN CASE WHEN h.max_rtt > 0 THEN h.max_rtt ELSE h.rtt END END), 0),
+		        MAX(h.hostname)
+		 FROM hops h JOIN traces t ON t.id = h.trace_id
+		 WHERE t.destination = ?
+		   AND (? = '' OR t.created_at >= ?)
+		   AND (? = '' OR t.created_at < ?)
+		 GROUP BY h.ttl, h.ip, bucket
+		 ORDER BY h.ttl, h.ip, bucket`,
+		format, destination, fromStr, fromStr, toStr, toStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []HopSeries{}
+	for rows.Next() {
+		var ttl int
+		var ip string
+		var hostname string
+		var p HopSample
+		if err := rows.Scan(&ttl, &ip, &p.Time, &p.Traces, &p.Sent, &p.Received,
+			&p.MinRTT, &p.AvgRTT, &p.MaxRTT, &hostname); err != nil {
+			return nil, err
+		}
+		if p.Sent > 0 {
+			p.Loss = float64(p.Sent-p.Received) / float64(p.Sent) * 100
+		}
+		if n := len(series); n == 0 || series[n-1].TTL != ttl || series[n-1].IP != ip {
+			series = append(series, HopSeries{TTL: ttl, IP: ip})
+		}
+		s := &series[len(series)-1]
+		s.Points = append(s.Points, p)
+		if hostname != "" {
+			s.Hostname = hostname // buckets come oldest first
+		}
+	}
+	return series, rows.Err()
+}
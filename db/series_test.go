@@ -0,0 +1,126 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHopSeries(t *testing.T) {
+	d := openTestDB(t)
+	at := func(hour, min int) time.Time { return time.Date(2024, 3, 1, hour, min, 0, 0, time.UTC) }
+
+	saveAt(t, d, "example.com", at(10, 5),
+		HopRecord{TTL: 1, IP: "10.0.0.1", Hostname: "gw.lan", Success: true, RTT: 1, Sent: 3, Received: 3, MinRTT: 0.5, AvgRTT: 1, MaxRTT: 1.5},
+		HopRecord{TTL: 2, Sent: 3},
+		HopRecord{TTL: 3, IP: "192.0.2.1", Success: true, IsFinal: true, RTT: 10, Sent: 3, Received: 2, MinRTT: 10, AvgRTT: 11, MaxRTT: 12},
+	)
+	saveAt(t, d, "example.com", at(10, 40),
+		HopRecord{TTL: 1, IP: "10.0.0.1", Success: true, RTT: 0.7, Sent: 3, Received: 3, MinRTT: 0.7, AvgRTT: 0.8, MaxRTT: 0.9},
+		HopRecord{TTL: 2, IP: "198.51.100.1", Hostname: "core.example.net", Success: true, RTT: 5, Sent: 3, Received: 3, MinRTT: 5, AvgRTT: 5, MaxRTT: 5},
+		HopRecord{TTL: 3, IP: "192.0.2.1", Success: true, IsFinal: true, RTT: 9, Sent: 3, Received: 3, MinRTT: 9, AvgRTT: 10, MaxRTT: 11},
+	)
+	// Imported hops have no probe counts and count as one probe each.
+	saveAt(t, d, "example.com", at(11, 10),
+		HopRecord{TTL: 1, IP: "10.0.0.1", Hostname: "gw2.lan", Success: true, RTT: 2},
+		HopRecord{TTL: 2},
+		HopRecord{TTL: 3, IP: "192.0.2.1", Success: true, IsFinal: true, RTT: 20},
+	)
+	// Other destinations are left out.
+	saveAt(t, d, "example.net", at(10, 10),
+		HopRecord{TTL: 1, IP: "10.0.0.1", Success: true, RTT: 100, Sent: 1, Received: 1, MinRTT: 100, AvgRTT: 100, MaxRTT: 100},
+		HopRecord{TTL: 4, IP: "203.0.113.1", Success: true, RTT: 100},
+	)
+
+	tests := []struct {
+		name     string
+		bucket   string
+		from, to time.Time
+		want     []HopSeries
+	}{
+		{
+			name:   "hourly",
+			bucket: BucketHour,
+			want: []HopSeries{
+				{TTL: 1, IP: "10.0.0.1", Hostname: "gw2.lan", Points: []HopSample{
+					{Time: "2024-03-01T10:00:00Z", Traces: 2, Sent: 6, Received: 6, MinRTT: 0.5, AvgRTT: (1 + 0.8) / 2, MaxRTT: 1.5},
+					{Time: "2024-03-01T11:00:00Z", Traces: 1, Sent: 1, Received: 1, MinRTT: 2, AvgRTT: 2, MaxRTT: 2},
+				}},
+				// Timeouts sort before the addresses answering at the
+				// same TTL.
+				{TTL: 2, IP: "", Points: []HopSample{
+					{Time: "2024-03-01T10:00:00Z", Traces: 1, Sent: 3, Loss: 100},
+					{Time: "2024-03-01T11:00:00Z", Traces: 1, Sent: 1, Loss: 100},
+				}},
+				{TTL: 2, IP: "198.51.100.1", Hostname: "core.example.net", Points: []HopSample{
+					{Time: "2024-03-01T10:00:00Z", Traces: 1, Sent: 3, Received: 3, MinRTT: 5, AvgRTT: 5, MaxRTT: 5},
+				}},
+				{TTL: 3, IP: "192.0.2.1", Points: []HopSample{
+					{Time: "2024-03-01T10:00:00Z", Traces: 2, Sent: 6, Received: 5, Loss: 100.0 / 6, MinRTT: 9, AvgRTT: 10.5, MaxRTT: 12},
+					{Time: "2024-03-01T11:00:00Z", Traces: 1, Sent: 1, Received: 1, MinRTT: 20, AvgRTT: 20, MaxRTT: 20},
+				}},
+			},
+		},
+		{
+			name:   "daily in a range",
+			bucket: BucketDay,
+			from:   at(10, 40),
+			to:     at(11, 10),
+			want: []HopSeries{
+				{TTL: 1, IP: "10.0.0.1", Points: []HopSample{
+					{Time: "2024-03-01T00:00:00Z", Traces: 1, Sent: 3, Received: 3, MinRTT: 0.7, AvgRTT: 0.8, MaxRTT: 0.9},
+				}},
+				{TTL: 2, IP: "198.51.100.1", Hostname: "core.example.net", Points: []HopSample{
+					{Time: "2024-03-01T00:00:00Z", Traces: 1, Sent: 3, Received: 3, MinRTT: 5, AvgRTT: 5, MaxRTT: 5},
+				}},
+				{TTL: 3, IP: "192.0.2.1", Points: []HopSample{
+					{Time: "2024-03-01T00:00:00Z", Traces: 1, Sent: 3, Received: 3, MinRTT: 9, AvgRTT: 10, MaxRTT: 11},
+				}},
+			},
+		},
+		{
+			name:   "nothing in range",
+			bucket: BucketMinute,
+			from:   at(12, 0),
+			want:   []HopSeries{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.HopSeries("example.com", tt.bucket, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				t.Error("got nil, want an empty slice")
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d series, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				s := got[i]
+				if s.TTL != want.TTL || s.IP != want.IP || s.Hostname != want.Hostname || len(s.Points) != len(want.Points) {
+					t.Errorf("series %d = TTL %d %q %q with %d points, want TTL %d %q %q with %d",
+						i, s.TTL, s.IP, s.Hostname, len(s.Points), want.TTL, want.IP, want.Hostname, len(want.Points))
+					continue
+				}
+				for j, p := range s.Points {
+					if !sampleEqual(p, want.Points[j]) {
+						t.Errorf("TTL %d %q point %d = %+v, want %+v", s.TTL, s.IP, j, p, want.Points[j])
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := d.HopSeries("example.com", "week", time.Time{}, time.Time{}); err == nil {
+		t.Error("an unknown bucket was accepted")
+	}
+}
+
+// sampleEqual compares samples, allowing for rounding in the averages.
+func sampleEqual(a, b HopSample) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+	return a.Time == b.Time && a.Traces == b.Traces && a.Sent == b.Sent && a.Received == b.Received &&
+		near(a.Loss, b.Loss) && near(a.MinRTT, b.MinRTT) && near(a.AvgRTT, b.AvgRTT) && near(a.MaxRTT, b.MaxRTT)
+}
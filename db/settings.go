@@ -0,0 +1,35 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// Setting decodes the JSON stored under key into v, reporting false and
+// leaving v alone if nothing has been stored.
+func (d *DB) Setting(key string, v any) (bool, error) {
+	var value string
+	err := d.conn.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(value), v)
+}
+
+// SetSetting stores v as JSON under key, replacing any earlier value.
+func (d *DB) SetSetting(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.Exec(
+		`INSERT INTO settings (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		key, string(value),
+	)
+	return err
+}
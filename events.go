@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// appEvent is an event as sent to the frontend, tagged with the session it
+// belongs to (0 for none) so API clients can follow one trace.
+type appEvent struct {
+	Session int64
+	Name    string
+	Data    []any
+}
+
+// eventBuffer is how many events an API client may fall behind by before it
+// is dropped; a slow client must not hold up the traces producing them.
+const eventBuffer = 1024
+
+// eventHub fans events out to the API clients listening for them.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan appEvent]bool
+}
+
+// subscribe returns a channel receiving every event from now on, and a
+// function that ends the subscription.  The channel is closed when the
+// subscription ends, including when the hub drops a client that fell too
+// far behind.
+func (h *eventHub) subscribe() (<-chan appEvent, func()) {
+	ch := make(chan appEvent, eventBuffer)
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = map[chan appEvent]bool{}
+	}
+	h.subs[ch] = true
+	h.mu.Unlock()
+	return ch, func() { h.drop(ch) }
+}
+
+func (h *eventHub) drop(ch chan appEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[ch] {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (h *eventHub) publish(e appEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// emit sends an event to the frontend, if there is one, and to API clients.
+func (a *App) emit(session int64, name string, data ...any) {
+	if a.gui {
+		runtime.EventsEmit(a.ctx, name, data...)
+	}
+	a.events.publish(appEvent{Session: session, Name: name, Data: data})
+}
+
+// logErrorf logs through Wails when it is running, and to stderr otherwise.
+func (a *App) logErrorf(format string, args ...any) {
+	if a.gui {
+		runtime.LogErrorf(a.ctx, format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
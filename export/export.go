@@ -0,0 +1,214 @@
+// Package export serializes stored traces for use outside the app.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"app/db"
+)
+
+// Format names an export file format.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+	FormatText Format = "text" // classic traceroute output
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatJSON, FormatCSV, FormatText}
+
+// Extension returns the file name extension for f, without the dot.
+func (f Format) Extension() string {
+	if f == FormatText {
+		return "txt"
+	}
+	return string(f)
+}
+
+// Trace is a stored trace: its summary row plus its hops.
+type Trace struct {
+	db.TraceRecord
+	Hops []db.HopRecord `json:"hops"`
+}
+
+// Write serializes t to w in the given format.
+func Write(w io.Writer, f Format, t Trace) error {
+	switch f {
+	case FormatJSON:
+		return writeJSON(w, t)
+	case FormatCSV:
+		return writeCSV(w, t)
+	case FormatText:
+		return writeText(w, t)
+	default:
+		return fmt.Errorf("export: unknown format %q", f)
+	}
+}
+
+func writeJSON(w io.Writer, t Trace) error {
+	if t.Hops == nil {
+		t.Hops = []db.HopRecord{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+var csvHeader = []string{
+	"trace_id", "destination", "created_at", "ttl", "ip", "hostname", "success", "is_final",
+	"rtt", "sent", "received", "loss", "min_rtt", "avg_rtt", "max_rtt", "stddev_rtt", "jitter",
+	"responders", "asn", "as_name", "as_boundary", "country_code", "country", "city", "latitude", "longitude",
+	"mpls",
+}
+
+// writeCSV writes one row per hop.  Each row repeats the trace columns so
+// rows from several exports can be concatenated; responders are packed into
+// one column as ip=count pairs separated by semicolons, and MPLS labels as
+// traceroute -e prints them.
+func writeCSV(w io.Writer, t Trace) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, h := range t.Hops {
+		responders := make([]string, len(h.Responders))
+		for i, r := range h.Responders {
+			responders[i] = r.IP + "=" + strconv.Itoa(r.Count)
+		}
+		row := []string{
+			strconv.FormatInt(t.ID, 10), t.Destination, t.CreatedAt,
+			strconv.Itoa(h.TTL), h.IP, h.Hostname,
+			strconv.FormatBool(h.Success), strconv.FormatBool(h.IsFinal),
+			formatFloat(h.RTT), strconv.Itoa(h.Sent), strconv.Itoa(h.Received), formatFloat(h.Loss),
+			formatFloat(h.MinRTT), formatFloat(h.AvgRTT), formatFloat(h.MaxRTT),
+			formatFloat(h.StdDevRTT), formatFloat(h.Jitter),
+			strings.Join(responders, ";"),
+			strconv.Itoa(h.ASN), h.ASName, strconv.FormatBool(h.ASBoundary),
+			h.CountryCode, h.Country, h.City, formatFloat(h.Latitude), formatFloat(h.Longitude),
+			formatMPLS(h.MPLS),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeText writes the trace the way traceroute(8) prints it:
+//
+//	traceroute to example.com (93.184.216.34), 3 hops
+//	 1  router.lan (192.168.1.1)  0.512 ms  0.640 ms  0.803 ms
+//	 2  * * *
+//	 3  93.184.216.34 (93.184.216.34) [AS15133]  11.204 ms  11.731 ms *
+//
+// Individual probe times are not stored, so a hop's answered probes are
+// shown as its minimum, average and maximum RTT, and lost probes as "*".
+// Continuous sessions probe each hop many times; their losses are counted
+// instead.  Known AS numbers are shown as traceroute -A does, and MPLS label
+// stacks as traceroute -e does.
+func writeText(w io.Writer, t Trace) error {
+	dest := t.Destination
+	for _, h := range t.Hops {
+		if h.IsFinal && h.IP != "" {
+			dest = fmt.Sprintf("%s (%s)", t.Destination, h.IP)
+		}
+	}
+	if _, err := fmt.Fprintf(w, "traceroute to %s, %d hops\n", dest, len(t.Hops)); err != nil {
+		return err
+	}
+
+	for _, h := range t.Hops {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%2d ", h.TTL)
+		lost := h.Sent - h.Received
+		switch {
+		case !h.Success:
+			lost = max(h.Sent, 1)
+		case len(h.Responders) > 1:
+			// Several routers answered this TTL: name each before its times.
+			for _, r := range h.Responders {
+				fmt.Fprintf(&b, " %s", host(r.IP, r.Hostname))
+				if r.IP == h.IP {
+					writeASN(&b, h.ASN)
+				}
+				writeTimes(&b, r.Count, r.AvgRTT, r.MinRTT, r.AvgRTT, r.MaxRTT)
+			}
+		default:
+			fmt.Fprintf(&b, " %s", host(h.IP, h.Hostname))
+			writeASN(&b, h.ASN)
+			writeTimes(&b, h.Received, h.RTT, h.MinRTT, h.AvgRTT, h.MaxRTT)
+		}
+		if h.Sent > 3 && lost > 0 {
+			// A continuous session: stars for every lost probe won't fit.
+			fmt.Fprintf(&b, "  (%d/%d lost)", lost, h.Sent)
+		} else {
+			for i := 0; i < lost; i++ {
+				b.WriteString(" *")
+			}
+		}
+		if len(h.MPLS) > 0 {
+			fmt.Fprintf(&b, " <MPLS:%s>", formatMPLS(h.MPLS))
+		}
+		b.WriteByte('\n')
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func host(ip, hostname string) string {
+	if hostname == "" {
+		hostname = ip
+	}
+	return fmt.Sprintf("%s (%s)", hostname, ip)
+}
+
+func writeASN(b *strings.Builder, asn int) {
+	if asn != 0 {
+		fmt.Fprintf(b, " [AS%d]", asn)
+	}
+}
+
+// formatMPLS formats a label stack as "L=24001,E=0,S=1,T=1", stack entries
+// separated by slashes.
+func formatMPLS(labels []db.MPLSLabelRecord) string {
+	entries := make([]string, len(labels))
+	for i, l := range labels {
+		s := 0
+		if l.S {
+			s = 1
+		}
+		entries[i] = fmt.Sprintf("L=%d,E=%d,S=%d,T=%d", l.Label, l.TC, s, l.TTL)
+	}
+	return strings.Join(entries, "/")
+}
+
+// writeTimes writes up to three times for n answered probes.  Hops saved
+// before per-hop statistics were recorded have n == 0 and only rtt.
+func writeTimes(b *strings.Builder, n int, rtt, lo, mean, hi float64) {
+	var times []float64
+	switch {
+	case n <= 1 || lo == 0:
+		times = []float64{rtt}
+	case n == 2:
+		times = []float64{lo, hi}
+	default:
+		times = []float64{lo, mean, hi}
+	}
+	for _, ms := range times {
+		fmt.Fprintf(b, "  %.3f ms", ms)
+	}
+}
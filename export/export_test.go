@@ -0,0 +1,178 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"app/db"
+)
+
+// sample is a finished three-hop trace with a lost hop and a lost probe.
+var sample = Trace{
+	TraceRecord: db.TraceRecord{ID: 7, Destination: "example.com", CreatedAt: "2024-01-02T15:04:05Z", HopCount: 2, TimeoutCount: 1},
+	Hops: []db.HopRecord{
+		{TTL: 1, IP: "192.168.1.1", Hostname: "router.lan", Success: true, RTT: 0.512,
+			Sent: 3, Received: 3, MinRTT: 0.512, AvgRTT: 0.64, MaxRTT: 0.803},
+		{TTL: 2, Sent: 3, Loss: 100},
+		{TTL: 3, IP: "93.184.216.34", Success: true, IsFinal: true, RTT: 11.204,
+			Sent: 3, Received: 2, Loss: 33.3, MinRTT: 11.204, AvgRTT: 11.4675, MaxRTT: 11.731, ASN: 15133},
+	},
+}
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace Trace
+		want  string
+	}{
+		{
+			name:  "min, avg and max with losses",
+			trace: sample,
+			want: `traceroute to example.com (93.184.216.34), 3 hops
+ 1  router.lan (192.168.1.1)  0.512 ms  0.640 ms  0.803 ms
+ 2  * * *
+ 3  93.184.216.34 (93.184.216.34) [AS15133]  11.204 ms  11.731 ms *
+`,
+		},
+		{
+			name: "not reached",
+			trace: Trace{TraceRecord: db.TraceRecord{Destination: "example.net"}, Hops: []db.HopRecord{
+				{TTL: 1, IP: "10.0.0.1", Success: true, RTT: 1, Sent: 1, Received: 1, MinRTT: 1, AvgRTT: 1, MaxRTT: 1},
+				{TTL: 2, Sent: 1},
+			}},
+			want: `traceroute to example.net, 2 hops
+ 1  10.0.0.1 (10.0.0.1)  1.000 ms
+ 2  *
+`,
+		},
+		{
+			name: "continuous",
+			trace: Trace{TraceRecord: db.TraceRecord{Destination: "10.0.0.1"}, Hops: []db.HopRecord{
+				{TTL: 1, IP: "10.0.0.1", Success: true, IsFinal: true, RTT: 2,
+					Sent: 20, Received: 18, MinRTT: 1, AvgRTT: 2, MaxRTT: 3},
+			}},
+			want: `traceroute to 10.0.0.1 (10.0.0.1), 1 hops
+ 1  10.0.0.1 (10.0.0.1)  1.000 ms  2.000 ms  3.000 ms  (2/20 lost)
+`,
+		},
+		{
+			// Hops saved before probe counts were recorded.
+			name: "without statistics",
+			trace: Trace{TraceRecord: db.TraceRecord{Destination: "10.0.0.2"}, Hops: []db.HopRecord{
+				{TTL: 1, IP: "10.0.0.1", Success: true, RTT: 5},
+				{TTL: 2},
+			}},
+			want: `traceroute to 10.0.0.2, 2 hops
+ 1  10.0.0.1 (10.0.0.1)  5.000 ms
+ 2  *
+`,
+		},
+		{
+			name: "several responders",
+			trace: Trace{TraceRecord: db.TraceRecord{Destination: "10.0.0.9"}, Hops: []db.HopRecord{
+				{TTL: 1, IP: "10.0.0.1", Success: true, RTT: 1, ASN: 64500, Sent: 3, Received: 3,
+					Responders: []db.ResponderRecord{
+						{IP: "10.0.0.1", Count: 2, MinRTT: 1, AvgRTT: 1.5, MaxRTT: 2},
+						{IP: "10.0.0.2", Hostname: "b.example", Count: 1, MinRTT: 3, AvgRTT: 3, MaxRTT: 3},
+					}},
+			}},
+			want: `traceroute to 10.0.0.9, 1 hops
+ 1  10.0.0.1 (10.0.0.1) [AS64500]  1.000 ms  2.000 ms b.example (10.0.0.2)  3.000 ms
+`,
+		},
+		{
+			name: "MPLS",
+			trace: Trace{TraceRecord: db.TraceRecord{Destination: "10.0.0.9"}, Hops: []db.HopRecord{
+				{TTL: 1, IP: "10.0.0.1", Success: true, RTT: 1, Sent: 1, Received: 1,
+					MPLS: []db.MPLSLabelRecord{{Label: 24001, TTL: 1}, {Label: 16, S: true, TTL: 1}}},
+			}},
+			want: `traceroute to 10.0.0.9, 1 hops
+ 1  10.0.0.1 (10.0.0.1)  1.000 ms <MPLS:L=24001,E=0,S=0,T=1/L=16,E=0,S=1,T=1>
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, FormatText, tt.trace); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, sample); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+len(sample.Hops) {
+		t.Fatalf("got %d rows, want a header and %d hops", len(rows), len(sample.Hops))
+	}
+	if !reflect.DeepEqual(rows[0], csvHeader) {
+		t.Errorf("header = %v", rows[0])
+	}
+
+	// The columns worth checking, by header name, for each hop.
+	want := []map[string]string{
+		{"trace_id": "7", "destination": "example.com", "ttl": "1", "ip": "192.168.1.1", "hostname": "router.lan",
+			"success": "true", "is_final": "false", "sent": "3", "received": "3", "min_rtt": "0.512", "avg_rtt": "0.64", "max_rtt": "0.803"},
+		{"ttl": "2", "ip": "", "success": "false", "sent": "3", "received": "0", "loss": "100", "rtt": "0"},
+		{"ttl": "3", "ip": "93.184.216.34", "is_final": "true", "received": "2", "loss": "33.3", "asn": "15133", "mpls": ""},
+	}
+	col := map[string]int{}
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	for i, hop := range want {
+		for name, v := range hop {
+			if got := rows[i+1][col[name]]; got != v {
+				t.Errorf("hop %d %s = %q, want %q", i+1, name, got, v)
+			}
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	for _, trace := range []Trace{sample, {TraceRecord: db.TraceRecord{ID: 1, Destination: "empty"}}} {
+		var buf bytes.Buffer
+		if err := Write(&buf, FormatJSON, trace); err != nil {
+			t.Fatal(err)
+		}
+		// Hops is always an array, never null.
+		if !strings.Contains(buf.String(), `"hops": [`) {
+			t.Errorf("%s: no hops array in %s", trace.Destination, buf.String())
+		}
+		var got Trace
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if trace.Hops == nil {
+			trace.Hops = []db.HopRecord{}
+		}
+		if !reflect.DeepEqual(got, trace) {
+			t.Errorf("%s: round trip = %+v, want %+v", trace.Destination, got, trace)
+		}
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, Format("xml"), sample); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q for an unknown format", buf.String())
+	}
+}
@@ -1,21 +1,40 @@
-import { createSignal, createMemo, onCleanup, Show } from 'solid-js';
+import { createSignal, createMemo, onCleanup, onMount, Show } from 'solid-js';
 import type { Component } from 'solid-js';
 import SearchBar from './components/SearchBar';
 import HopTable from './components/HopTable';
 import HistoryPanel from './components/HistoryPanel';
-import type { HopData, HopRecord, TraceRecord } from './types';
+import type { APISettings, ExportFormat, HopData, HopEvent, HopRecord, HopSeries, HostnameEvent, PathChangeRecord, PathDiff, RetentionPolicy, ScheduleRecord, SearchResult, SeriesBucket, TraceOptions, TraceQuery, TraceRecord } from './types';
 
 declare global {
   interface Window {
     go?: {
       main?: {
         App?: {
-          StartTraceroute: (host: string, maxHops: number, timeoutMs: number) => Promise<void>;
-          StopTraceroute: () => Promise<void>;
+          StartTraceroute: (host: string, opts: TraceOptions) => Promise<number>;
+          StopTraceroute: (sessionId: number) => Promise<boolean>;
           GetHostSuggestions: () => Promise<string[]>;
           GetHistory: (destination: string, limit: number) => Promise<TraceRecord[]>;
+          SearchTraces: (query: TraceQuery) => Promise<SearchResult>;
           GetTrace: (id: number) => Promise<HopRecord[]>;
           DeleteTrace: (id: number) => Promise<void>;
+          ExportTrace: (id: number, format: ExportFormat) => Promise<string>;
+          ImportTrace: (text: string, source: string) => Promise<number>;
+          ImportTraceFile: (source: string) => Promise<number>;
+          CompareTraces: (fromId: number, toId: number) => Promise<PathDiff>;
+          GetPathChanges: (destination: string, limit: number) => Promise<PathChangeRecord[]>;
+          GetHopSeries: (destination: string, bucket: SeriesBucket, from: string, to: string) => Promise<HopSeries[]>;
+          ImportASNFile: () => Promise<number>;
+          CreateSchedule: (destination: string, intervalMinutes: number, opts: TraceOptions) => Promise<number>;
+          ListSchedules: () => Promise<ScheduleRecord[]>;
+          PauseSchedule: (id: number) => Promise<void>;
+          ResumeSchedule: (id: number) => Promise<void>;
+          DeleteSchedule: (id: number) => Promise<void>;
+          DeleteTraces: (destination: string, from: string, to: string) => Promise<number>;
+          GetRetentionPolicy: () => Promise<RetentionPolicy>;
+          SetRetentionPolicy: (policy: RetentionPolicy) => Promise<number>;
+          CompactHistory: () => Promise<void>;
+          GetAPISettings: () => Promise<APISettings>;
+          SetAPISettings: (settings: APISettings) => Promise<APISettings>;
         };
       };
     };
@@ -38,12 +57,18 @@ const App: Component = () => {
   const [destination, setDestination] = createSignal('');
   const [errorMsg, setErrorMsg] = createSignal('');
   const [maxHopsHit, setMaxHopsHit] = createSignal(0);
+  const [pathChange, setPathChange] = createSignal<PathDiff | null>(null);
   const [showHistory, setShowHistory] = createSignal(false);
   const [showOptions, setShowOptions] = createSignal(false);
   const [maxHops, setMaxHops] = createSignal(30);
   const [timeoutMs, setTimeoutMs] = createSignal(1000);
   const [savedTraceId, setSavedTraceId] = createSignal(0);
+  const [pruned, setPruned] = createSignal(0); // bumped when retention deletes traces
   const [pendingHost, setPendingHost] = createSignal('');
+  const [asnStatus, setAsnStatus] = createSignal('');
+  const [retention, setRetention] = createSignal<RetentionPolicy>({ maxTracesPerDestination: 0, maxAgeDays: 0, maxSizeMb: 0 });
+  const [api, setApi] = createSignal<APISettings>({ enabled: false, addr: '', token: '' });
+  const [apiStatus, setApiStatus] = createSignal('');
 
   // When a historical trace is loaded, display its hops instead of the live ones
   const [historicalHops, setHistoricalHops] = createSignal<HopData[] | null>(null);
@@ -60,23 +85,37 @@ const App: Component = () => {
   });
 
   let offHop: (() => void) | undefined;
+  let offHostname: (() => void) | undefined;
   let offDone: (() => void) | undefined;
   let offError: (() => void) | undefined;
   let offMaxHops: (() => void) | undefined;
   let offSaved: (() => void) | undefined;
+  let offPathChanged: (() => void) | undefined;
+
+  // Session of the trace on screen.  Session IDs only increase, so until
+  // StartTraceroute returns, any session newer than the last one is ours.
+  let session = 0;
+  let lastSession = 0;
+  const ours = (id: unknown) => (session ? Number(id) === session : Number(id) > lastSession);
 
   const teardownListeners = () => {
-    offHop?.(); offDone?.(); offError?.(); offMaxHops?.(); offSaved?.();
-    offHop = offDone = offError = offMaxHops = offSaved = undefined;
+    offHop?.(); offHostname?.(); offDone?.(); offError?.(); offMaxHops?.(); offSaved?.(); offPathChanged?.();
+    offHop = offHostname = offDone = offError = offMaxHops = offSaved = offPathChanged = undefined;
   };
 
   onCleanup(teardownListeners);
 
   const handleStart = async (host: string) => {
+    if (session && isRunning()) {
+      window.go?.main?.App?.StopTraceroute(session).catch(() => {});
+    }
     teardownListeners();
+    lastSession = Math.max(lastSession, session);
+    session = 0;
     setHopMap(new Map());
     setErrorMsg('');
     setMaxHopsHit(0);
+    setPathChange(null);
     setHistoricalHops(null);
     setHistoricalLabel('');
     setState('running');
@@ -84,7 +123,8 @@ const App: Component = () => {
 
     if (window.runtime) {
       offHop = window.runtime.EventsOn('hop', (data: unknown) => {
-        const hop = data as HopData;
+        const hop = data as HopEvent;
+        if (!ours(hop.sessionId)) return;
         setHopMap((prev) => {
           const next = new Map(prev);
 
@@ -108,27 +148,55 @@ const App: Component = () => {
           return next;
         });
       });
-      offDone = window.runtime.EventsOn('traceroute:done', () => {
+      // Reverse DNS answers for hops already on screen
+      offHostname = window.runtime.EventsOn('hop:hostname', (data: unknown) => {
+        const { sessionId, ttl, ip, hostname } = data as HostnameEvent;
+        if (!ours(sessionId)) return;
+        setHopMap((prev) => {
+          const hop = prev.get(ttl);
+          if (!hop) return prev;
+          const next = new Map(prev);
+          next.set(ttl, {
+            ...hop,
+            hostname: hop.ip === ip && !hop.hostname ? hostname : hop.hostname,
+            responders: hop.responders?.map((r) => (r.ip === ip && !r.hostname ? { ...r, hostname } : r)),
+          });
+          return next;
+        });
+      });
+      offDone = window.runtime.EventsOn('traceroute:done', (id: unknown) => {
+        if (!ours(id)) return;
         setState('done');
         teardownListeners();
       });
-      offError = window.runtime.EventsOn('traceroute:error', (msg: unknown) => {
-        setErrorMsg(String(msg));
+      offError = window.runtime.EventsOn('traceroute:error', (data: unknown) => {
+        const { sessionId, error } = data as { sessionId: number; error: string };
+        if (!ours(sessionId)) return;
+        setErrorMsg(error);
         setState('error');
         teardownListeners();
       });
-      offMaxHops = window.runtime.EventsOn('traceroute:maxhops', (n: unknown) => {
-        setMaxHopsHit(Number(n));
+      offMaxHops = window.runtime.EventsOn('traceroute:maxhops', (data: unknown) => {
+        const { sessionId, maxHops: n } = data as { sessionId: number; maxHops: number };
+        if (!ours(sessionId)) return;
+        setMaxHopsHit(n);
         setState('maxhops');
         teardownListeners();
       });
-      offSaved = window.runtime.EventsOn('traceroute:saved', (id: unknown) => {
+      // Imports and schedules save traces too; only sessions pass an ID
+      offSaved = window.runtime.EventsOn('traceroute:saved', (id: unknown, sessionId: unknown) => {
+        if (!ours(sessionId)) return;
         setSavedTraceId(Number(id));
       });
+      // Sent after saving, before the terminal event
+      offPathChanged = window.runtime.EventsOn('traceroute:pathchanged', (diff: unknown, sessionId: unknown) => {
+        if (!ours(sessionId)) return;
+        setPathChange(diff as PathDiff);
+      });
     }
 
     try {
-      await window.go?.main?.App?.StartTraceroute(host, maxHops(), timeoutMs());
+      session = (await window.go?.main?.App?.StartTraceroute(host, { maxHops: maxHops(), timeoutMs: timeoutMs(), probes: 3 })) ?? 0;
     } catch (e) {
       setErrorMsg(String(e));
       setState('error');
@@ -136,11 +204,53 @@ const App: Component = () => {
   };
 
   const handleStop = async () => {
-    try { await window.go?.main?.App?.StopTraceroute(); } catch (_) {}
+    try { await window.go?.main?.App?.StopTraceroute(session); } catch (_) {}
     setState('done');
     teardownListeners();
   };
 
+  const handleImportASN = async () => {
+    try {
+      const n = await window.go?.main?.App?.ImportASNFile();
+      if (n) setAsnStatus(`${n.toLocaleString()} ranges loaded`);
+    } catch (e) {
+      setAsnStatus(String(e));
+    }
+  };
+
+  onMount(async () => {
+    const policy = await window.go?.main?.App?.GetRetentionPolicy();
+    if (policy) setRetention(policy);
+    const settings = await window.go?.main?.App?.GetAPISettings();
+    if (settings) setApi(settings);
+  });
+
+  // The app answers with the settings in effect, which stay the old ones if
+  // the API could not listen on the new address
+  const updateApi = async (change: Partial<APISettings>) => {
+    setApiStatus('');
+    try {
+      const settings = await window.go?.main?.App?.SetAPISettings({ ...api(), ...change });
+      if (settings) setApi(settings);
+    } catch (e) {
+      setApiStatus(String(e));
+      const settings = await window.go?.main?.App?.GetAPISettings();
+      if (settings) setApi(settings);
+    }
+  };
+
+  // Saving applies the policy at once; refresh history if it removed anything
+  const updateRetention = async (change: Partial<RetentionPolicy>) => {
+    const policy = { ...retention(), ...change };
+    setRetention(policy);
+    try {
+      const n = await window.go?.main?.App?.SetRetentionPolicy(policy);
+      if (n) setPruned((p) => p + 1);
+    } catch (e) {
+      setErrorMsg(String(e));
+    }
+  };
+
   const handleLoadTrace = (hops: HopRecord[], record: TraceRecord) => {
     // Convert HopRecord → HopData for the table
     const asHopData: HopData[] = hops.map((h) => ({
@@ -151,6 +261,15 @@ const App: Component = () => {
       success: h.success,
       isFinal: h.isFinal,
       isTimeout: !h.success,
+      asn: h.asn,
+      asName: h.asName,
+      asBoundary: h.asBoundary,
+      countryCode: h.countryCode,
+      country: h.country,
+      city: h.city,
+      latitude: h.latitude,
+      longitude: h.longitude,
+      mpls: h.mpls,
     }));
     setHistoricalHops(asHopData);
     const time = new Date(record.createdAt).toLocaleTimeString(undefined, { hour: '2-digit', minute: '2-digit' });
@@ -272,11 +391,125 @@ const App: Component = () => {
                 <span class="text-xs text-ink-tertiary">ms</span>
               </div>
             </label>
+            <div class="flex items-center gap-2.5 ml-auto">
+              <Show when={asnStatus()}>
+                <span class="text-xs text-ink-tertiary">{asnStatus()}</span>
+              </Show>
+              <button
+                type="button"
+                onClick={handleImportASN}
+                title="Load an IP-to-ASN table to label hops with their autonomous system"
+                class="h-7 px-2.5 rounded-lg border border-surface-200 text-xs font-medium text-ink-secondary bg-white hover:border-surface-300 transition-colors duration-100"
+              >
+                ASN data…
+              </button>
+            </div>
+          </div>
+          {/* History retention; 0 = no limit */}
+          <div class="mt-2 flex items-center gap-5 px-1">
+            <span class="text-xs font-medium text-ink-tertiary uppercase tracking-wider">Keep history</span>
+            <label class="flex items-center gap-1">
+              <input
+                type="number"
+                min="0"
+                value={retention().maxTracesPerDestination}
+                onChange={(e) => updateRetention({ maxTracesPerDestination: Math.max(parseInt(e.currentTarget.value) || 0, 0) })}
+                class="w-16 h-7 px-2 rounded-lg border border-surface-200 text-sm font-mono text-center bg-white focus:outline-none focus:border-accent text-ink"
+              />
+              <span class="text-xs text-ink-tertiary">per host</span>
+            </label>
+            <label class="flex items-center gap-1">
+              <input
+                type="number"
+                min="0"
+                value={retention().maxAgeDays}
+                onChange={(e) => updateRetention({ maxAgeDays: Math.max(parseInt(e.currentTarget.value) || 0, 0) })}
+                class="w-16 h-7 px-2 rounded-lg border border-surface-200 text-sm font-mono text-center bg-white focus:outline-none focus:border-accent text-ink"
+              />
+              <span class="text-xs text-ink-tertiary">days</span>
+            </label>
+            <label class="flex items-center gap-1">
+              <input
+                type="number"
+                min="0"
+                value={retention().maxSizeMb}
+                onChange={(e) => updateRetention({ maxSizeMb: Math.max(parseInt(e.currentTarget.value) || 0, 0) })}
+                class="w-16 h-7 px-2 rounded-lg border border-surface-200 text-sm font-mono text-center bg-white focus:outline-none focus:border-accent text-ink"
+              />
+              <span class="text-xs text-ink-tertiary">MB</span>
+            </label>
+          </div>
+          {/* Local HTTP API for scripts; only loopback addresses are accepted */}
+          <div class="mt-2 flex items-center gap-5 px-1">
+            <label class="flex items-center gap-1.5">
+              <input
+                type="checkbox"
+                checked={api().enabled}
+                onChange={(e) => updateApi({ enabled: e.currentTarget.checked })}
+              />
+              <span class="text-xs font-medium text-ink-tertiary uppercase tracking-wider">HTTP API</span>
+            </label>
+            <input
+              type="text"
+              value={api().addr}
+              onChange={(e) => updateApi({ addr: e.currentTarget.value.trim() })}
+              title="Loopback address and port to listen on"
+              class="w-40 h-7 px-2 rounded-lg border border-surface-200 text-sm font-mono bg-white focus:outline-none focus:border-accent text-ink"
+            />
+            <label class="flex items-center gap-1">
+              <span class="text-xs text-ink-tertiary">token</span>
+              <input
+                type="text"
+                readOnly
+                value={api().token}
+                onFocus={(e) => e.currentTarget.select()}
+                class="w-72 h-7 px-2 rounded-lg border border-surface-200 text-xs font-mono bg-white focus:outline-none focus:border-accent text-ink-secondary"
+              />
+            </label>
+            <button
+              type="button"
+              onClick={() => updateApi({ token: '' })}
+              title="Replace the token; clients using the old one are refused"
+              class="h-7 px-2.5 rounded-lg border border-surface-200 text-xs font-medium text-ink-secondary bg-white hover:border-surface-300 transition-colors duration-100"
+            >
+              New token
+            </button>
+            <Show when={apiStatus()}>
+              <span class="text-xs text-ink-tertiary">{apiStatus()}</span>
+            </Show>
           </div>
         </Show>
       </div>
 
       {/* Max hops warning */}
+      <Show when={pathChange()}>
+        {(diff) => (
+          <div class="mx-5 mb-3 flex items-start gap-3 px-4 py-3 rounded-xl bg-accent/5 border border-accent/20 shrink-0">
+            <svg width="15" height="15" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round" class="text-accent mt-0.5 shrink-0">
+              <polyline points="16 3 21 3 21 8"/><line x1="4" y1="20" x2="21" y2="3"/>
+              <polyline points="21 16 21 21 16 21"/><line x1="15" y1="15" x2="21" y2="21"/><line x1="4" y1="4" x2="9" y2="9"/>
+            </svg>
+            <div>
+              <p class="text-sm font-medium text-accent">Path changed since the previous trace</p>
+              <p class="text-xs text-ink-secondary mt-0.5">
+                {diff().rerouted} rerouted · {diff().added} added · {diff().removed} removed
+                <Show when={diff().hops.some((h) => h.kind === 'changed')}>
+                  {' '}(first at hop <span class="font-mono font-medium">{diff().hops.find((h) => h.kind === 'changed')!.ttl}</span>)
+                </Show>
+              </p>
+            </div>
+            <button
+              onClick={() => setPathChange(null)}
+              class="ml-auto w-5 h-5 flex items-center justify-center rounded text-ink-tertiary hover:text-ink-secondary hover:bg-surface-200 transition-colors"
+            >
+              <svg width="12" height="12" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.5" stroke-linecap="round">
+                <line x1="18" y1="6" x2="6" y2="18"/><line x1="6" y1="6" x2="18" y2="18"/>
+              </svg>
+            </button>
+          </div>
+        )}
+      </Show>
+
       <Show when={state() === 'maxhops'}>
         <div class="mx-5 mb-3 flex items-start gap-3 px-4 py-3 rounded-xl bg-warning/5 border border-warning/20 shrink-0">
           <svg width="15" height="15" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round" class="text-warning mt-0.5 shrink-0">
@@ -334,6 +567,7 @@ const App: Component = () => {
           destination={destination()}
           currentTotalRtt={currentTotalRtt()}
           savedTraceId={savedTraceId()}
+          pruned={pruned()}
           onLoadTrace={handleLoadTrace}
           onClose={() => setShowHistory(false)}
         />
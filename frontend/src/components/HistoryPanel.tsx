@@ -1,6 +1,6 @@
 import { createSignal, createEffect, For, Show } from 'solid-js';
 import type { Component } from 'solid-js';
-import type { TraceRecord, HopRecord } from '../types';
+import type { TraceRecord, HopRecord, ExportFormat, SearchResult, TraceQuery } from '../types';
 
 interface HistoryPanelProps {
   destination: string;          // current destination being viewed
@@ -9,6 +9,16 @@ interface HistoryPanelProps {
   onClose: () => void;
   // trigger a refresh when a new trace is saved
   savedTraceId: number;
+  // ... or when the retention policy removed some
+  pruned: number;
+}
+
+const PAGE_SIZE = 50;
+
+// An address filters on the hops that answered from it; anything else on
+// their hostnames.
+function filterQuery(text: string): TraceQuery {
+  return /^[0-9a-f.:]+$/i.test(text) && /[.:]/.test(text) ? { hopIp: text } : { hostname: text };
 }
 
 function formatTime(iso: string): string {
@@ -41,22 +51,49 @@ const HistoryPanel: Component<HistoryPanelProps> = (props) => {
   const [loading, setLoading] = createSignal(false);
   const [expandedId, setExpandedId] = createSignal<number | null>(null);
   const [expandedHops, setExpandedHops] = createSignal<HopRecord[]>([]);
+  const [filter, setFilter] = createSignal('');
+  const [total, setTotal] = createSignal(0); // matches of the filter, over all pages
+
+  const search = (offset: number): Promise<SearchResult | undefined> =>
+    (window as any).go?.main?.App?.SearchTraces({
+      ...filterQuery(filter().trim()),
+      destination: props.destination,
+      offset,
+      limit: PAGE_SIZE,
+    });
 
   const load = async () => {
     setLoading(true);
     try {
+      if (filter().trim()) {
+        const res = await search(0);
+        setRecords(res?.traces ?? []);
+        setTotal(res?.total ?? 0);
+        return;
+      }
       // Empty destination → fetch all; otherwise fetch for this host
-      const res = await (window as any).go?.main?.App?.GetHistory(props.destination, 50) ?? [];
+      const res = await (window as any).go?.main?.App?.GetHistory(props.destination, PAGE_SIZE) ?? [];
       setRecords(res ?? []);
+      setTotal(0);
+    } catch (err) {
+      console.error('search failed:', err);
     } finally {
       setLoading(false);
     }
   };
 
-  // Reload whenever destination changes or a new trace is saved
+  const loadMore = async () => {
+    const res = await search(records().length);
+    setRecords((prev) => [...prev, ...(res?.traces ?? [])]);
+    setTotal(res?.total ?? 0);
+  };
+
+  // Reload whenever destination or filter changes or a new trace is saved
   createEffect(() => {
     props.destination;
     props.savedTraceId;
+    props.pruned;
+    filter();
     load();
   });
 
@@ -73,14 +110,54 @@ const HistoryPanel: Component<HistoryPanelProps> = (props) => {
 
   const handleDelete = async (e: MouseEvent, id: number) => {
     e.stopPropagation();
-    await (window as any).go?.main?.App?.DeleteTrace(id);
+    try {
+      await (window as any).go?.main?.App?.DeleteTrace(id);
+    } catch (err) {
+      console.error('delete failed:', err);
+    }
     setRecords((prev) => prev.filter((r) => r.id !== id));
+    setTotal((n) => Math.max(n - 1, 0));
     if (expandedId() === id) {
       setExpandedId(null);
       setExpandedHops([]);
     }
   };
 
+  const handleExport = async (id: number, format: ExportFormat) => {
+    try {
+      await (window as any).go?.main?.App?.ExportTrace(id, format);
+    } catch (err) {
+      console.error('export failed:', err);
+    }
+  };
+
+  // Deletes everything listed: this destination's traces, or all of them.
+  // DeleteTraces wants some bound, so clearing everything names the end of
+  // the range, just past the current second the stored times are rounded to.
+  const handleClear = async () => {
+    const what = props.destination ? `all traces to ${props.destination}` : 'all history';
+    if (!window.confirm(`Delete ${what}?`)) return;
+    const to = props.destination ? '' : new Date(Date.now() + 1000).toISOString();
+    try {
+      await (window as any).go?.main?.App?.DeleteTraces(props.destination, '', to);
+      await (window as any).go?.main?.App?.CompactHistory();
+    } catch (err) {
+      console.error('clear failed:', err);
+    }
+    setExpandedId(null);
+    setExpandedHops([]);
+    load();
+  };
+
+  // The app emits traceroute:saved after an import, which reloads the list.
+  const handleImport = async () => {
+    try {
+      await (window as any).go?.main?.App?.ImportTraceFile('');
+    } catch (err) {
+      console.error('import failed:', err);
+    }
+  };
+
   const handleLoad = async (e: MouseEvent, record: TraceRecord) => {
     e.stopPropagation();
     const hops = await (window as any).go?.main?.App?.GetTrace(record.id) ?? [];
@@ -102,14 +179,39 @@ const HistoryPanel: Component<HistoryPanelProps> = (props) => {
             }
           </span>
         </div>
-        <button
-          onClick={props.onClose}
-          class="w-5 h-5 flex items-center justify-center rounded text-ink-tertiary hover:text-ink-secondary hover:bg-surface-200 transition-colors"
-        >
-          <svg width="12" height="12" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.5" stroke-linecap="round">
-            <line x1="18" y1="6" x2="6" y2="18"/><line x1="6" y1="6" x2="18" y2="18"/>
-          </svg>
-        </button>
+        <div class="flex items-center gap-1">
+          <input
+            type="search"
+            placeholder="Hop address or hostname"
+            value={filter()}
+            onChange={(e) => setFilter(e.currentTarget.value)}
+            class="h-5 w-44 px-1.5 rounded border border-surface-200 bg-white text-xs font-mono text-ink placeholder:text-ink-disabled focus:outline-none focus:border-accent"
+          />
+          <button
+            title="Import traceroute, tracert or mtr output"
+            onClick={handleImport}
+            class="h-5 px-1.5 flex items-center rounded text-xs text-ink-tertiary hover:text-ink-secondary hover:bg-surface-200 transition-colors"
+          >
+            Import…
+          </button>
+          <Show when={records().length > 0}>
+            <button
+              title={props.destination ? `Delete every trace to ${props.destination}` : 'Delete all history'}
+              onClick={handleClear}
+              class="h-5 px-1.5 flex items-center rounded text-xs text-ink-tertiary hover:text-danger hover:bg-danger/8 transition-colors"
+            >
+              Clear
+            </button>
+          </Show>
+          <button
+            onClick={props.onClose}
+            class="w-5 h-5 flex items-center justify-center rounded text-ink-tertiary hover:text-ink-secondary hover:bg-surface-200 transition-colors"
+          >
+            <svg width="12" height="12" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.5" stroke-linecap="round">
+              <line x1="18" y1="6" x2="6" y2="18"/><line x1="6" y1="6" x2="18" y2="18"/>
+            </svg>
+          </button>
+        </div>
       </div>
 
       {/* Body */}
@@ -127,7 +229,9 @@ const HistoryPanel: Component<HistoryPanelProps> = (props) => {
           fallback={
             <div class="flex items-center justify-center py-8">
               <p class="text-xs text-ink-tertiary">
-                {props.destination ? `No history yet for ${props.destination}` : 'No traces recorded yet'}
+                {filter().trim()
+                  ? `No traces match ${filter().trim()}`
+                  : props.destination ? `No history yet for ${props.destination}` : 'No traces recorded yet'}
               </p>
             </div>
           }
@@ -163,6 +267,26 @@ const HistoryPanel: Component<HistoryPanelProps> = (props) => {
                       </span>
                     </Show>
 
+                    {/* Imported traces ran elsewhere, so say where */}
+                    <Show when={record.imported}>
+                      <span
+                        title={record.source ? `Imported from ${record.source}` : 'Imported'}
+                        class="text-[10px] uppercase tracking-wide text-ink-tertiary border border-surface-200 px-1 rounded shrink-0 max-w-[120px] truncate"
+                      >
+                        {record.source || 'imported'}
+                      </span>
+                    </Show>
+
+                    {/* How the trace ended, unless it simply finished */}
+                    <Show when={record.status && record.status !== 'done' && !(record.continuous && record.status === 'stopped')}>
+                      <span
+                        title={record.error || (record.status === 'maxhops' ? `Not reached within ${record.maxHops} hops` : 'Stopped before finishing')}
+                        class={`text-[10px] uppercase tracking-wide border px-1 rounded shrink-0 ${record.status === 'error' ? 'text-danger border-danger/30' : 'text-warning border-warning/30'}`}
+                      >
+                        {record.status === 'maxhops' ? 'max hops' : record.status}
+                      </span>
+                    </Show>
+
                     {/* Hop count */}
                     <span class="text-xs text-ink-secondary">
                       <span class="font-medium">{record.hopCount}</span>
@@ -228,12 +352,33 @@ const HistoryPanel: Component<HistoryPanelProps> = (props) => {
                           </div>
                         )}
                       </For>
+                      <div class="flex items-center gap-2 pt-1.5 mt-1 border-t border-surface-100 text-xs">
+                        <span class="text-ink-tertiary">Export</span>
+                        <For each={[['json', 'JSON'], ['csv', 'CSV'], ['text', 'Text']] as [ExportFormat, string][]}>
+                          {([format, label]) => (
+                            <button
+                              onClick={() => handleExport(record.id, format)}
+                              class="px-1.5 py-0.5 rounded text-ink-secondary hover:text-accent hover:bg-accent/8 transition-colors"
+                            >
+                              {label}
+                            </button>
+                          )}
+                        </For>
+                      </div>
                     </div>
                   </Show>
                 </div>
               );
             }}
           </For>
+          <Show when={records().length < total()}>
+            <button
+              onClick={loadMore}
+              class="w-full py-2 text-xs text-ink-tertiary hover:text-ink-secondary hover:bg-surface-100 transition-colors"
+            >
+              Show more ({total() - records().length} left)
+            </button>
+          </Show>
         </Show>
       </Show>
     </div>
@@ -28,6 +28,9 @@ function formatRtt(rtt: number): string {
 const HopRow: Component<HopRowProps> = (props) => {
   const animDelay = () => `${Math.min(props.index * 30, 300)}ms`;
   const barWidth  = () => `${Math.max((props.hop.rtt / Math.max(props.maxRtt, 1)) * 100, 1)}%`;
+  const place     = () => [props.hop.city, props.hop.countryCode].filter(Boolean).join(', ');
+  const mpls      = () => (props.hop.mpls ?? []).map((l) => l.label).join(' / ');
+  const mplsTitle = () => (props.hop.mpls ?? []).map((l) => `L=${l.label} TC=${l.tc} S=${l.s ? 1 : 0} TTL=${l.ttl}`).join('\n');
 
   return (
     <div
@@ -55,6 +58,22 @@ const HopRow: Component<HopRowProps> = (props) => {
             <Show when={!props.hop.hostname || props.hop.hostname === props.hop.ip}>
               <div class="font-mono text-sm font-medium text-ink select-all">{props.hop.ip}</div>
             </Show>
+            {/* Autonomous system; a boundary is where the path enters a new one */}
+            <Show when={props.hop.asn}>
+              <div
+                class={`text-xs mt-0.5 truncate ${props.hop.asBoundary ? 'text-accent' : 'text-ink-tertiary'}`}
+                title={props.hop.asBoundary ? 'Enters a different autonomous system' : props.hop.asName}
+              >
+                AS{props.hop.asn}{props.hop.asName ? ` · ${props.hop.asName}` : ''}
+              </div>
+            </Show>
+            <Show when={place()}>
+              <div class="text-xs text-ink-tertiary mt-0.5 truncate" title={props.hop.country}>{place()}</div>
+            </Show>
+            {/* Inside an MPLS tunnel: the label stack the router saw */}
+            <Show when={mpls()}>
+              <div class="font-mono text-xs text-ink-tertiary mt-0.5 truncate" title={mplsTitle()}>MPLS {mpls()}</div>
+            </Show>
           </Match>
           <Match when={!props.hop.success}>
             <span class="font-mono text-sm text-ink-disabled">*</span>
@@ -1,3 +1,20 @@
+export interface Responder {
+  ip: string;
+  hostname: string;
+  count: number;     // probes answered
+  minRtt: number;
+  avgRtt: number;
+  maxRtt: number;
+}
+
+// One entry of an MPLS label stack (RFC 4950), outermost first.
+export interface MPLSLabel {
+  label: number;
+  tc: number;   // traffic class
+  s: boolean;   // bottom of stack
+  ttl: number;
+}
+
 export interface HopData {
   ttl: number;
   ip: string;
@@ -6,9 +23,41 @@ export interface HopData {
   success: boolean;
   isFinal: boolean;
   isTimeout: boolean;
+  portState?: '' | 'open' | 'closed'; // TCP destination hop only
+  sent?: number;
+  received?: number;
+  loss?: number;       // percent
+  minRtt?: number;
+  avgRtt?: number;
+  maxRtt?: number;
+  stdDevRtt?: number;
+  jitter?: number;
+  responders?: Responder[]; // more than one = ECMP fan-out
+  asn?: number;        // 0 = unknown
+  asName?: string;
+  asBoundary?: boolean; // first hop into a different AS
+  countryCode?: string; // ISO 3166-1 alpha-2, '' = unknown
+  country?: string;
+  city?: string;
+  latitude?: number;
+  longitude?: number;
+  mpls?: MPLSLabel[] | null; // non-empty = inside an MPLS tunnel
   isPending?: boolean; // true = result not yet arrived, show skeleton
 }
 
+// Payload of the "hop" event.
+export interface HopEvent extends HopData {
+  sessionId: number; // returned by StartTraceroute
+}
+
+// Payload of the "hop:hostname" event: a name that arrived after its hop.
+export interface HostnameEvent {
+  sessionId: number;
+  ttl: number;
+  ip: string;
+  hostname: string;
+}
+
 export interface TraceRecord {
   id: number;
   destination: string;
@@ -16,8 +65,76 @@ export interface TraceRecord {
   hopCount: number;
   timeoutCount: number;
   totalRtt: number;   // ms
+  ipVersion: number;  // 4 or 6, 0 if no hop answered
+  imported?: boolean; // parsed from pasted traceroute/tracert/mtr output
+  source?: string;    // host an imported trace ran on, if known
+  // How the trace was run and ended; zero for imported and older traces
+  maxHops?: number;
+  timeoutMs?: number;
+  probes?: number;
+  method?: ProbeMethod;
+  continuous?: boolean;
+  destIp?: string;    // the address the destination resolved to
+  status?: TraceStatus;
+  error?: string;
 }
 
+// One hop's RTT and loss to a destination over time, from GetHopSeries.
+export interface HopSeries {
+  ttl: number;
+  ip: string;          // '' for the probes at this TTL that got no reply
+  hostname: string;
+  points: HopSample[]; // oldest first
+}
+
+export type SeriesBucket = 'minute' | 'hour' | 'day';
+
+export interface HopSample {
+  time: string;        // RFC3339 start of the bucket, UTC
+  traces: number;
+  sent: number;
+  received: number;
+  loss: number;        // percent
+  minRtt: number;      // ms; 0 when nothing answered
+  avgRtt: number;
+  maxRtt: number;
+}
+
+// Filters for SearchTraces; empty or zero fields match every trace.
+export interface TraceQuery {
+  destination?: string; // substring
+  hopIp?: string;       // any hop answered from this address
+  hostname?: string;    // substring of any hop's hostname
+  since?: string;       // RFC3339, inclusive
+  until?: string;       // RFC3339, exclusive
+  reached?: boolean;
+  minRtt?: number;      // ms, to the destination
+  maxRtt?: number;
+  offset?: number;
+  limit?: number;       // 50 when unset
+}
+
+export interface SearchResult {
+  traces: TraceRecord[]; // most recent first
+  total: number;         // matches over all pages
+}
+
+// How much history is kept; 0 = no limit.
+export interface RetentionPolicy {
+  maxTracesPerDestination: number;
+  maxAgeDays: number;
+  maxSizeMb: number; // whole database file
+}
+
+// The HTTP API served while the window is open
+export interface APISettings {
+  enabled: boolean;
+  addr: string; // loopback host:port
+  token: string;
+}
+
+export type TraceStatus = '' | 'done' | 'maxhops' | 'stopped' | 'error';
+
 export interface HopRecord {
   ttl: number;
   ip: string;
@@ -25,4 +142,96 @@ export interface HopRecord {
   rtt: number;
   success: boolean;
   isFinal: boolean;
+  sent?: number;
+  received?: number;
+  loss?: number;       // percent
+  minRtt?: number;
+  avgRtt?: number;
+  maxRtt?: number;
+  stdDevRtt?: number;
+  jitter?: number;
+  responders?: Responder[] | null;
+  asn?: number;
+  asName?: string;
+  asBoundary?: boolean;
+  countryCode?: string;
+  country?: string;
+  city?: string;
+  latitude?: number;
+  longitude?: number;
+  mpls?: MPLSLabel[] | null;
+}
+
+export type ProbeMethod = '' | 'icmp' | 'udp' | 'tcp' | 'exec';
+
+export interface TraceOptions {
+  maxHops: number;
+  timeoutMs: number;
+  probes?: number;       // per TTL, default 1
+  ipVersion?: 0 | 4 | 6; // 0 = prefer IPv4
+  continuous?: boolean;  // MTR-style: keep probing until stopped
+  intervalMs?: number;   // between continuous rounds
+  method?: ProbeMethod;  // '' = auto
+  port?: number;         // first UDP destination port, or the TCP port
+  portRange?: number;
+  paris?: boolean;       // keep the flow constant so each TTL takes one path
+  flowId?: number;       // first Paris flow
+  flows?: number;        // Paris flows cycled per TTL, to find alternate paths
+  dnsServer?: string;    // reverse DNS server, '' = system resolver
+  dnsTimeoutMs?: number; // per reverse lookup
+}
+
+export type ExportFormat = 'json' | 'csv' | 'text';
+
+export type HopDiffKind = 'same' | 'changed' | 'added' | 'removed' | 'unknown';
+
+export interface HopDiff {
+  ttl: number;
+  kind: HopDiffKind;
+  oldIp: string;
+  oldHostname: string;
+  newIp: string;
+  newHostname: string;
+  oldRtt: number;   // ms, 0 if unanswered
+  newRtt: number;
+  rttDelta: number; // newRtt - oldRtt, 0 unless both answered
+}
+
+export interface PathDiff {
+  fromId: number;
+  toId: number;
+  destination: string;
+  changed: boolean;
+  added: number;
+  removed: number;
+  rerouted: number;
+  hops: HopDiff[];
+}
+
+export interface PathChangeRecord {
+  id: number;
+  traceId: number;
+  prevTraceId: number;
+  destination: string;
+  createdAt: string; // RFC3339
+  diff: PathDiff;
+}
+
+export interface ScheduleRecord {
+  id: number;
+  destination: string;
+  intervalMinutes: number;
+  options: TraceOptions;
+  paused: boolean;
+  createdAt: string; // RFC3339
+  lastRunAt: string; // RFC3339, '' if never run
+  lastTraceId: number; // 0 if the last run saved nothing
+  lastError: string;
+}
+
+// Payload of the "schedule:ran" event.
+export interface ScheduleRun {
+  scheduleId: number;
+  traceId: number;
+  error: string;
 }
@@ -1,15 +1,56 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {main} from '../models';
+import {pathdiff} from '../models';
 import {db} from '../models';
+import {traceroute} from '../models';
+
+export function CompactHistory():Promise<void>;
+
+export function CompareTraces(arg1:number,arg2:number):Promise<pathdiff.Diff>;
+
+export function CreateSchedule(arg1:string,arg2:number,arg3:traceroute.Options):Promise<number>;
+
+export function DeleteSchedule(arg1:number):Promise<void>;
 
 export function DeleteTrace(arg1:number):Promise<void>;
 
+export function DeleteTraces(arg1:string,arg2:string,arg3:string):Promise<number>;
+
+export function ExportTrace(arg1:number,arg2:string):Promise<string>;
+
+export function GetAPISettings():Promise<main.APISettings>;
+
 export function GetHistory(arg1:string,arg2:number):Promise<Array<db.TraceRecord>>;
 
+export function GetHopSeries(arg1:string,arg2:string,arg3:string,arg4:string):Promise<Array<db.HopSeries>>;
+
 export function GetHostSuggestions():Promise<Array<string>>;
 
+export function GetPathChanges(arg1:string,arg2:number):Promise<Array<db.PathChangeRecord>>;
+
+export function GetRetentionPolicy():Promise<db.RetentionPolicy>;
+
 export function GetTrace(arg1:number):Promise<Array<db.HopRecord>>;
 
-export function StartTraceroute(arg1:string,arg2:number,arg3:number):Promise<void>;
+export function ImportASNFile():Promise<number>;
+
+export function ImportTrace(arg1:string,arg2:string):Promise<number>;
+
+export function ImportTraceFile(arg1:string):Promise<number>;
+
+export function ListSchedules():Promise<Array<db.ScheduleRecord>>;
+
+export function PauseSchedule(arg1:number):Promise<void>;
+
+export function ResumeSchedule(arg1:number):Promise<void>;
+
+export function SetAPISettings(arg1:main.APISettings):Promise<main.APISettings>;
+
+export function SearchTraces(arg1:db.TraceQuery):Promise<db.SearchResult>;
+
+export function SetRetentionPolicy(arg1:db.RetentionPolicy):Promise<number>;
+
+export function StartTraceroute(arg1:string,arg2:traceroute.Options):Promise<number>;
 
-export function StopTraceroute():Promise<void>;
+export function StopTraceroute(arg1:number):Promise<boolean>;
@@ -2,26 +2,102 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function CompactHistory() {
+  return window['go']['main']['App']['CompactHistory']();
+}
+
+export function CompareTraces(arg1, arg2) {
+  return window['go']['main']['App']['CompareTraces'](arg1, arg2);
+}
+
+export function CreateSchedule(arg1, arg2, arg3) {
+  return window['go']['main']['App']['CreateSchedule'](arg1, arg2, arg3);
+}
+
+export function DeleteSchedule(arg1) {
+  return window['go']['main']['App']['DeleteSchedule'](arg1);
+}
+
 export function DeleteTrace(arg1) {
   return window['go']['main']['App']['DeleteTrace'](arg1);
 }
 
+export function DeleteTraces(arg1, arg2, arg3) {
+  return window['go']['main']['App']['DeleteTraces'](arg1, arg2, arg3);
+}
+
+export function ExportTrace(arg1, arg2) {
+  return window['go']['main']['App']['ExportTrace'](arg1, arg2);
+}
+
+export function GetAPISettings() {
+  return window['go']['main']['App']['GetAPISettings']();
+}
+
 export function GetHistory(arg1, arg2) {
   return window['go']['main']['App']['GetHistory'](arg1, arg2);
 }
 
+export function GetHopSeries(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['GetHopSeries'](arg1, arg2, arg3, arg4);
+}
+
 export function GetHostSuggestions() {
   return window['go']['main']['App']['GetHostSuggestions']();
 }
 
+export function GetPathChanges(arg1, arg2) {
+  return window['go']['main']['App']['GetPathChanges'](arg1, arg2);
+}
+
+export function GetRetentionPolicy() {
+  return window['go']['main']['App']['GetRetentionPolicy']();
+}
+
 export function GetTrace(arg1) {
   return window['go']['main']['App']['GetTrace'](arg1);
 }
 
-export function StartTraceroute(arg1, arg2, arg3) {
-  return window['go']['main']['App']['StartTraceroute'](arg1, arg2, arg3);
+export function ImportASNFile() {
+  return window['go']['main']['App']['ImportASNFile']();
+}
+
+export function ImportTrace(arg1, arg2) {
+  return window['go']['main']['App']['ImportTrace'](arg1, arg2);
+}
+
+export function ImportTraceFile(arg1) {
+  return window['go']['main']['App']['ImportTraceFile'](arg1);
+}
+
+export function ListSchedules() {
+  return window['go']['main']['App']['ListSchedules']();
+}
+
+export function PauseSchedule(arg1) {
+  return window['go']['main']['App']['PauseSchedule'](arg1);
+}
+
+export function ResumeSchedule(arg1) {
+  return window['go']['main']['App']['ResumeSchedule'](arg1);
+}
+
+export function SetAPISettings(arg1) {
+  return window['go']['main']['App']['SetAPISettings'](arg1);
+}
+
+export function SearchTraces(arg1) {
+  return window['go']['main']['App']['SearchTraces'](arg1);
+}
+
+export function SetRetentionPolicy(arg1) {
+  return window['go']['main']['App']['SetRetentionPolicy'](arg1);
+}
+
+export function StartTraceroute(arg1, arg2) {
+  return window['go']['main']['App']['StartTraceroute'](arg1, arg2);
 }
 
-export function StopTraceroute() {
-  return window['go']['main']['App']['StopTraceroute']();
+export function StopTraceroute(arg1) {
+  return window['go']['main']['App']['StopTraceroute'](arg1);
 }
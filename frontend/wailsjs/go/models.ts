@@ -1,5 +1,45 @@
 export namespace db {
 	
+	export class ResponderRecord {
+	    ip: string;
+	    hostname: string;
+	    count: number;
+	    minRtt: number;
+	    avgRtt: number;
+	    maxRtt: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ResponderRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ip = source["ip"];
+	        this.hostname = source["hostname"];
+	        this.count = source["count"];
+	        this.minRtt = source["minRtt"];
+	        this.avgRtt = source["avgRtt"];
+	        this.maxRtt = source["maxRtt"];
+	    }
+	}
+	export class MPLSLabelRecord {
+	    label: number;
+	    tc: number;
+	    s: boolean;
+	    ttl: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MPLSLabelRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.label = source["label"];
+	        this.tc = source["tc"];
+	        this.s = source["s"];
+	        this.ttl = source["ttl"];
+	    }
+	}
 	export class HopRecord {
 	    ttl: number;
 	    ip: string;
@@ -7,6 +47,24 @@ export namespace db {
 	    rtt: number;
 	    success: boolean;
 	    isFinal: boolean;
+	    sent: number;
+	    received: number;
+	    loss: number;
+	    minRtt: number;
+	    avgRtt: number;
+	    maxRtt: number;
+	    stdDevRtt: number;
+	    jitter: number;
+	    responders: ResponderRecord[];
+	    asn: number;
+	    asName: string;
+	    asBoundary: boolean;
+	    countryCode: string;
+	    country: string;
+	    city: string;
+	    latitude: number;
+	    longitude: number;
+	    mpls: MPLSLabelRecord[];
 	
 	    static createFrom(source: any = {}) {
 	        return new HopRecord(source);
@@ -20,6 +78,169 @@ export namespace db {
 	        this.rtt = source["rtt"];
 	        this.success = source["success"];
 	        this.isFinal = source["isFinal"];
+	        this.sent = source["sent"];
+	        this.received = source["received"];
+	        this.loss = source["loss"];
+	        this.minRtt = source["minRtt"];
+	        this.avgRtt = source["avgRtt"];
+	        this.maxRtt = source["maxRtt"];
+	        this.stdDevRtt = source["stdDevRtt"];
+	        this.jitter = source["jitter"];
+	        this.responders = this.convertValues(source["responders"], ResponderRecord);
+	        this.asn = source["asn"];
+	        this.asName = source["asName"];
+	        this.asBoundary = source["asBoundary"];
+	        this.countryCode = source["countryCode"];
+	        this.country = source["country"];
+	        this.city = source["city"];
+	        this.latitude = source["latitude"];
+	        this.longitude = source["longitude"];
+	        this.mpls = this.convertValues(source["mpls"], MPLSLabelRecord);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class HopSample {
+	    time: string;
+	    traces: number;
+	    sent: number;
+	    received: number;
+	    loss: number;
+	    minRtt: number;
+	    avgRtt: number;
+	    maxRtt: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HopSample(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = source["time"];
+	        this.traces = source["traces"];
+	        this.sent = source["sent"];
+	        this.received = source["received"];
+	        this.loss = source["loss"];
+	        this.minRtt = source["minRtt"];
+	        this.avgRtt = source["avgRtt"];
+	        this.maxRtt = source["maxRtt"];
+	    }
+	}
+	export class HopSeries {
+	    ttl: number;
+	    ip: string;
+	    hostname: string;
+	    points: HopSample[];
+	
+	    static createFrom(source: any = {}) {
+	        return new HopSeries(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ttl = source["ttl"];
+	        this.ip = source["ip"];
+	        this.hostname = source["hostname"];
+	        this.points = this.convertValues(source["points"], HopSample);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	export class PathChangeRecord {
+	    id: number;
+	    traceId: number;
+	    prevTraceId: number;
+	    destination: string;
+	    createdAt: string;
+	    diff: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new PathChangeRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.traceId = source["traceId"];
+	        this.prevTraceId = source["prevTraceId"];
+	        this.destination = source["destination"];
+	        this.createdAt = source["createdAt"];
+	        this.diff = source["diff"];
+	    }
+	}
+	export class RetentionPolicy {
+	    maxTracesPerDestination: number;
+	    maxAgeDays: number;
+	    maxSizeMb: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RetentionPolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.maxTracesPerDestination = source["maxTracesPerDestination"];
+	        this.maxAgeDays = source["maxAgeDays"];
+	        this.maxSizeMb = source["maxSizeMb"];
+	    }
+	}
+	export class ScheduleRecord {
+	    id: number;
+	    destination: string;
+	    intervalMinutes: number;
+	    options: any;
+	    paused: boolean;
+	    createdAt: string;
+	    lastRunAt: string;
+	    lastTraceId: number;
+	    lastError: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScheduleRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.destination = source["destination"];
+	        this.intervalMinutes = source["intervalMinutes"];
+	        this.options = source["options"];
+	        this.paused = source["paused"];
+	        this.createdAt = source["createdAt"];
+	        this.lastRunAt = source["lastRunAt"];
+	        this.lastTraceId = source["lastTraceId"];
+	        this.lastError = source["lastError"];
 	    }
 	}
 	export class TraceRecord {
@@ -29,6 +250,17 @@ export namespace db {
 	    hopCount: number;
 	    timeoutCount: number;
 	    totalRtt: number;
+	    ipVersion: number;
+	    imported: boolean;
+	    source: string;
+	    maxHops: number;
+	    timeoutMs: number;
+	    probes: number;
+	    method: string;
+	    continuous: boolean;
+	    destIp: string;
+	    status: string;
+	    error: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new TraceRecord(source);
@@ -42,6 +274,240 @@ export namespace db {
 	        this.hopCount = source["hopCount"];
 	        this.timeoutCount = source["timeoutCount"];
 	        this.totalRtt = source["totalRtt"];
+	        this.ipVersion = source["ipVersion"];
+	        this.imported = source["imported"];
+	        this.source = source["source"];
+	        this.maxHops = source["maxHops"];
+	        this.timeoutMs = source["timeoutMs"];
+	        this.probes = source["probes"];
+	        this.method = source["method"];
+	        this.continuous = source["continuous"];
+	        this.destIp = source["destIp"];
+	        this.status = source["status"];
+	        this.error = source["error"];
+	    }
+	}
+	export class SearchResult {
+	    traces: TraceRecord[];
+	    total: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.traces = this.convertValues(source["traces"], TraceRecord);
+	        this.total = source["total"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class TraceQuery {
+	    destination: string;
+	    hopIp: string;
+	    hostname: string;
+	    // Go type: time
+	    since: any;
+	    // Go type: time
+	    until: any;
+	    reached: boolean;
+	    minRtt: number;
+	    maxRtt: number;
+	    offset: number;
+	    limit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TraceQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.destination = source["destination"];
+	        this.hopIp = source["hopIp"];
+	        this.hostname = source["hostname"];
+	        this.since = this.convertValues(source["since"], null);
+	        this.until = this.convertValues(source["until"], null);
+	        this.reached = source["reached"];
+	        this.minRtt = source["minRtt"];
+	        this.maxRtt = source["maxRtt"];
+	        this.offset = source["offset"];
+	        this.limit = source["limit"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace main {
+	
+	export class APISettings {
+	    enabled: boolean;
+	    addr: string;
+	    token: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new APISettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.addr = source["addr"];
+	        this.token = source["token"];
+	    }
+	}
+
+}
+
+export namespace pathdiff {
+	
+	export class HopDiff {
+	    ttl: number;
+	    kind: string;
+	    oldIp: string;
+	    oldHostname: string;
+	    newIp: string;
+	    newHostname: string;
+	    oldRtt: number;
+	    newRtt: number;
+	    rttDelta: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HopDiff(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ttl = source["ttl"];
+	        this.kind = source["kind"];
+	        this.oldIp = source["oldIp"];
+	        this.oldHostname = source["oldHostname"];
+	        this.newIp = source["newIp"];
+	        this.newHostname = source["newHostname"];
+	        this.oldRtt = source["oldRtt"];
+	        this.newRtt = source["newRtt"];
+	        this.rttDelta = source["rttDelta"];
+	    }
+	}
+	export class Diff {
+	    fromId: number;
+	    toId: number;
+	    destination: string;
+	    changed: boolean;
+	    added: number;
+	    removed: number;
+	    rerouted: number;
+	    hops: HopDiff[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Diff(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.fromId = source["fromId"];
+	        this.toId = source["toId"];
+	        this.destination = source["destination"];
+	        this.changed = source["changed"];
+	        this.added = source["added"];
+	        this.removed = source["removed"];
+	        this.rerouted = source["rerouted"];
+	        this.hops = this.convertValues(source["hops"], HopDiff);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace traceroute {
+	
+	export class Options {
+	    maxHops: number;
+	    timeoutMs: number;
+	    probes: number;
+	    ipVersion: number;
+	    continuous: boolean;
+	    intervalMs: number;
+	    method: string;
+	    port: number;
+	    portRange: number;
+	    paris: boolean;
+	    flowId: number;
+	    flows: number;
+	    dnsServer: string;
+	    dnsTimeoutMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Options(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.maxHops = source["maxHops"];
+	        this.timeoutMs = source["timeoutMs"];
+	        this.probes = source["probes"];
+	        this.ipVersion = source["ipVersion"];
+	        this.continuous = source["continuous"];
+	        this.intervalMs = source["intervalMs"];
+	        this.method = source["method"];
+	        this.port = source["port"];
+	        this.portRange = source["portRange"];
+	        this.paris = source["paris"];
+	        this.flowId = source["flowId"];
+	        this.flows = source["flows"];
+	        this.dnsServer = source["dnsServer"];
+	        this.dnsTimeoutMs = source["dnsTimeoutMs"];
 	    }
 	}
 
@@ -0,0 +1,109 @@
+// Package geoip annotates hops with the location of their address, read from
+// a MaxMind-format (.mmdb) database such as GeoLite2-City or DB-IP's city
+// lite edition.  The file is supplied by the user and placed in the data
+// directory; lookups happen in memory and never touch the network.
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"app/traceroute"
+)
+
+// Location is where a database places an address.  Country-level databases
+// leave City and the coordinates empty.
+type Location struct {
+	CountryCode string  // ISO 3166-1 alpha-2, e.g. "DE"
+	Country     string  // English name
+	City        string  // English name
+	Latitude    float64 // degrees
+	Longitude   float64
+}
+
+// Reader looks up addresses in an opened database.  It is safe for
+// concurrent use.
+type Reader struct {
+	db *mmdb
+}
+
+var _ traceroute.Enricher = (*Reader)(nil)
+
+// Open reads the database at path into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := parseMMDB(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Find returns the path of the database to use in dir: the first .mmdb file
+// by name, preferring city-level ones.  It returns "" if there is none.
+func Find(dir string) string {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.mmdb"))
+	sort.SliceStable(paths, func(i, j int) bool {
+		ci := strings.Contains(strings.ToLower(filepath.Base(paths[i])), "city")
+		cj := strings.Contains(strings.ToLower(filepath.Base(paths[j])), "city")
+		return ci && !cj
+	})
+	if len(paths) == 0 {
+		return ""
+	}
+	return paths[0]
+}
+
+// Lookup returns the location of ip, and false if the database has none.
+func (r *Reader) Lookup(ip net.IP) (Location, bool) {
+	v, err := r.db.lookup(ip)
+	if err != nil || v == nil {
+		return Location{}, false
+	}
+	rec, _ := v.(map[string]any)
+	var loc Location
+	country := field(rec, "country")
+	if country == nil {
+		// Anycast and satellite networks may only name a continent or the
+		// country where they are registered.
+		country = field(rec, "registered_country")
+	}
+	loc.CountryCode, _ = country["iso_code"].(string)
+	loc.Country = englishName(country)
+	loc.City = englishName(field(rec, "city"))
+	location := field(rec, "location")
+	loc.Latitude, _ = location["latitude"].(float64)
+	loc.Longitude, _ = location["longitude"].(float64)
+	return loc, loc != Location{}
+}
+
+// Enrich sets the location of hop's address.  Private and other non-global
+// addresses are not looked up.
+func (r *Reader) Enrich(hop *traceroute.Hop) {
+	ip := net.ParseIP(hop.IP)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return
+	}
+	if loc, ok := r.Lookup(ip); ok {
+		hop.CountryCode, hop.Country, hop.City = loc.CountryCode, loc.Country, loc.City
+		hop.Latitude, hop.Longitude = loc.Latitude, loc.Longitude
+	}
+}
+
+// field returns the map stored under key in rec, or nil.
+func field(rec map[string]any, key string) map[string]any {
+	m, _ := rec[key].(map[string]any)
+	return m
+}
+
+// englishName returns the "names"."en" entry of a GeoIP2 place record.
+func englishName(place map[string]any) string {
+	name, _ := field(place, "names")["en"].(string)
+	return name
+}
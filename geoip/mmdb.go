@@ -0,0 +1,322 @@
+package geoip
+
+// A reader for the MaxMind DB file format used by GeoLite2, GeoIP2 and
+// DB-IP's free databases, as described at
+// https://maxmind.github.io/MaxMind-DB/.  The file is a binary search tree
+// over address bits whose leaves point into a data section of typed values.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errCorrupt is returned when the file does not follow the format.
+var errCorrupt = errors.New("geoip: corrupt MaxMind DB file")
+
+// maxDepth bounds the nesting of maps, arrays and pointers in a value, so a
+// pointer back into its own map cannot recurse forever.
+const maxDepth = 512
+
+// mmdb is an opened MaxMind DB held in memory.
+type mmdb struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint // bits per record: 24, 28 or 32
+	ipVersion  uint
+	dataStart  uint // offset of the data section in buf
+	ipv4Start  uint // node reached by the 96 zero bits of ::/96
+	dbType     string
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("geoip: not a MaxMind DB file")
+	}
+	// The metadata is decoded as if it began a data section.
+	meta := &mmdb{buf: buf, dataStart: uint(i + len(metadataMarker))}
+	v, _, err := meta.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, errCorrupt
+	}
+
+	db := &mmdb{
+		buf:        buf,
+		nodeCount:  uint(toUint(m["node_count"])),
+		recordSize: uint(toUint(m["record_size"])),
+		ipVersion:  uint(toUint(m["ip_version"])),
+	}
+	db.dbType, _ = m["database_type"].(string)
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+	if db.nodeCount > uint(i)/(db.recordSize/4) {
+		return nil, errCorrupt
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	db.dataStart = treeSize + 16 // 16 zero bytes separate tree and data
+	if db.dataStart > uint(i) {
+		return nil, errCorrupt
+	}
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for n := 0; n < 96 && node < db.nodeCount; n++ {
+			if node, err = db.record(node, 0); err != nil {
+				return nil, err
+			}
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// lookup returns the data record for ip, or nil if the database has none.
+func (db *mmdb) lookup(ip net.IP) (any, error) {
+	node := uint(0)
+	addr := ip.To4()
+	if addr != nil {
+		node = db.ipv4Start
+	} else if db.ipVersion == 6 {
+		addr = ip.To16()
+	}
+	if addr == nil {
+		return nil, nil // IPv6 address in an IPv4-only database
+	}
+
+	for bit := 0; bit < len(addr)*8 && node < db.nodeCount; bit++ {
+		var err error
+		if node, err = db.record(node, uint(addr[bit/8]>>(7-bit%8))&1); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil // no data for this network
+	case node < db.nodeCount+16:
+		// Records between the node count and the data section would
+		// point into the tree or the separator.
+		return nil, errCorrupt
+	}
+	offset := node - db.nodeCount - 16
+	v, _, err := db.decode(offset, 0)
+	return v, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a tree node.
+func (db *mmdb) record(node, bit uint) (uint, error) {
+	size := db.recordSize / 4 // bytes per node
+	off := node * size
+	if off+size > uint(len(db.buf)) {
+		return 0, errCorrupt
+	}
+	b := db.buf[off : off+size]
+	switch db.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4])), nil
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8])), nil
+	}
+}
+
+// Data section field types.
+const (
+	typePointer = 1
+	typeString  = 2
+	typeDouble  = 3
+	typeBytes   = 4
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeInt32   = 8
+	typeUint64  = 9
+	typeUint128 = 10
+	typeArray   = 11
+	typeBool    = 14
+	typeFloat   = 15
+)
+
+// decode decodes the value at offset within the data section and returns
+// it with the offset just past it.  Maps become map[string]any, arrays
+// []any, integers uint64 (int64 for int32) and uint128s their raw bytes.
+// depth is the number of maps, arrays and pointers the value is nested in.
+func (db *mmdb) decode(offset, depth uint) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+	data := db.buf[db.dataStart:]
+	next := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(data)) {
+			return nil, errCorrupt
+		}
+		b := data[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+
+	b, err := next(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ss := uint(ctrl>>3) & 3
+		p, err := next(ss + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var target uint
+		switch ss {
+		case 0:
+			target = uint(ctrl&7)<<8 | uint(p[0])
+		case 1:
+			target = (uint(ctrl&7)<<16 | uint(p[0])<<8 | uint(p[1])) + 2048
+		case 2:
+			target = (uint(ctrl&7)<<24 | uint(p[0])<<16 | uint(p[1])<<8 | uint(p[2])) + 526336
+		default:
+			target = uint(binary.BigEndian.Uint32(p))
+		}
+		// The format forbids pointers to pointers.
+		if target < uint(len(data)) && data[target]>>5 == typePointer {
+			return nil, 0, errCorrupt
+		}
+		v, _, err := db.decode(target, depth+1)
+		return v, offset, err
+	}
+
+	if typ == 0 { // extended type
+		if b, err = next(1); err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+	size := uint(ctrl & 0x1f)
+	switch size {
+	case 29:
+		if b, err = next(1); err != nil {
+			return nil, 0, err
+		}
+		size = 29 + uint(b[0])
+	case 30:
+		if b, err = next(2); err != nil {
+			return nil, 0, err
+		}
+		size = 285 + uint(binary.BigEndian.Uint16(b))
+	case 31:
+		if b, err = next(3); err != nil {
+			return nil, 0, err
+		}
+		size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+	}
+
+	// Every key, value and element takes at least a byte, so a size the
+	// rest of the data cannot hold is corrupt, not something to allocate.
+	remaining := uint(len(data)) - offset
+	switch typ {
+	case typeMap:
+		if size > remaining/2 {
+			return nil, 0, errCorrupt
+		}
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, after, err := db.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			v, after, err := db.decode(after, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], offset = v, after
+		}
+		return m, offset, nil
+	case typeArray:
+		if size > remaining {
+			return nil, 0, errCorrupt
+		}
+		a := make([]any, size)
+		for i := range a {
+			v, after, err := db.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a[i], offset = v, after
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if b, err = next(size); err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		if size == 4 {
+			return int64(int32(n)), offset, nil
+		}
+		return int64(n), offset, nil
+	case typeBytes, typeUint128:
+		return b, offset, nil
+	default:
+		// The data cache container and end marker never appear in
+		// records.
+		return nil, 0, errCorrupt
+	}
+}
+
+func toUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
@@ -0,0 +1,182 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The fixtures are tiny GeoIP2-City-shaped databases, one per record size,
+// holding 192.0.2.0/24 (Sydney), 21.0.0.0/8 (registered to the US only) and,
+// in the 32-bit one, 2001:db8::/32 (Sydney again).  Their keys and names are
+// shared through pointers, some far enough apart to need two-byte ones.
+var fixtures = []string{"city-ipv4-24.mmdb", "city-ipv6-28.mmdb", "city-ipv6-32.mmdb"}
+
+func TestLookup(t *testing.T) {
+	sydney := Location{CountryCode: "AU", Country: "Australia", City: "Sydney", Latitude: -33.86, Longitude: 151.2}
+	tests := []struct {
+		ip   string
+		want map[string]Location // by fixture; absent means no location
+	}{
+		{"192.0.2.1", map[string]Location{
+			"city-ipv4-24.mmdb": sydney,
+			"city-ipv6-28.mmdb": sydney,
+			"city-ipv6-32.mmdb": sydney,
+		}},
+		{"21.1.2.3", map[string]Location{
+			"city-ipv4-24.mmdb": {CountryCode: "US", Country: "United States"},
+			"city-ipv6-28.mmdb": {CountryCode: "US", Country: "United States"},
+			"city-ipv6-32.mmdb": {CountryCode: "US", Country: "United States"},
+		}},
+		{"2001:db8::1", map[string]Location{
+			"city-ipv6-32.mmdb": sydney,
+		}},
+		{"198.51.100.1", nil},
+		{"2001:db9::1", nil},
+	}
+
+	for _, file := range fixtures {
+		t.Run(file, func(t *testing.T) {
+			r, err := Open(filepath.Join("testdata", file))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			for _, tt := range tests {
+				want, wantOK := tt.want[file]
+				got, ok := r.Lookup(net.ParseIP(tt.ip))
+				if ok != wantOK || got != want {
+					t.Errorf("Lookup(%s) = %+v, %v, want %+v, %v", tt.ip, got, ok, want, wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMMDBMetadata(t *testing.T) {
+	for _, file := range fixtures {
+		buf, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := parseMMDB(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if db.dbType != "Test-City" || db.nodeCount == 0 {
+			t.Errorf("%s: type %q, %d nodes", file, db.dbType, db.nodeCount)
+		}
+	}
+}
+
+// metadata encodes a metadata section holding node_count, record_size and
+// ip_version, each as a uint64.
+func metadata(nodeCount, recordSize, ipVersion uint64) []byte {
+	b := append([]byte{}, metadataMarker...)
+	b = append(b, 7<<5|3) // map of three entries
+	for _, kv := range []struct {
+		key string
+		val uint64
+	}{{"node_count", nodeCount}, {"record_size", recordSize}, {"ip_version", ipVersion}} {
+		b = append(b, 2<<5|byte(len(kv.key)))
+		b = append(b, kv.key...)
+		b = append(b, 8, typeUint64-7) // extended type, eight bytes
+		b = binary.BigEndian.AppendUint64(b, kv.val)
+	}
+	return b
+}
+
+func TestParseMMDBCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"no metadata", []byte("not a database")},
+		{"metadata not a map", append(append([]byte{}, metadataMarker...), 2<<5|1, 'x')},
+		{"truncated metadata", append(append([]byte{}, metadataMarker...), 7<<5|3)},
+		{"bad record size", metadata(1, 20, 4)},
+		{"tree past the metadata", metadata(100, 24, 4)},
+		// node_count * record_size wraps around to zero, which would
+		// leave room for the tree in these 32 bytes.
+		{"node count overflow", append(make([]byte, 32), metadata(1<<62, 24, 6)...)},
+	}
+	for _, tt := range tests {
+		if _, err := parseMMDB(tt.buf); err == nil {
+			t.Errorf("%s: parseMMDB succeeded", tt.name)
+		}
+	}
+}
+
+func TestLookupRecordInSeparator(t *testing.T) {
+	buf, err := os.ReadFile(filepath.Join("testdata", "city-ipv4-24.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := parseMMDB(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []uint{db.nodeCount + 1, db.nodeCount + 15} {
+		// Point both records of the root, a 24-bit node, at record.
+		for i := range 2 {
+			buf[3*i], buf[3*i+1], buf[3*i+2] = byte(record>>16), byte(record>>8), byte(record)
+		}
+		if _, err := db.lookup(net.ParseIP("192.0.2.1")); !errors.Is(err, errCorrupt) {
+			t.Errorf("record %d: lookup error = %v, want errCorrupt", record, err)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want any
+	}{
+		{"string", []byte{2<<5 | 3, 'a', 'b', 'c'}, "abc"},
+		{"pointer", []byte{1 << 5, 2, 2<<5 | 1, 'x'}, "x"},
+		{"uint32", []byte{6<<5 | 2, 1, 0}, uint64(256)},
+		{"int32", []byte{4, typeInt32 - 7, 0xff, 0xff, 0xff, 0xfe}, int64(-2)},
+		{"bool", []byte{1, typeBool - 7}, true},
+		{"double", []byte{3<<5 | 8, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, 1.5},
+		{"array", []byte{2, typeArray - 7, 2<<5 | 1, 'a', 5<<5 | 1, 7}, []any{"a", uint64(7)}},
+		{"map", []byte{7<<5 | 1, 2<<5 | 1, 'k', 1 << 5, 1}, map[string]any{"k": "k"}},
+	}
+	for _, tt := range tests {
+		db := &mmdb{buf: tt.data}
+		got, _, err := db.decode(0, 0)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: decode = %#v, %v, want %#v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated string", []byte{2<<5 | 5, 'a'}},
+		{"pointer past the end", []byte{1 << 5, 0xff}},
+		{"pointer to pointer", []byte{1 << 5, 2, 1 << 5, 0}},
+		{"pointer to itself", []byte{1 << 5, 0}},
+		// {"a": <pointer to this map>} nests forever.
+		{"map containing itself", []byte{7<<5 | 1, 2<<5 | 1, 'a', 1 << 5, 0}},
+		{"map key not a string", []byte{7<<5 | 1, 5<<5 | 1, 1, 2<<5 | 1, 'a'}},
+		{"huge map", []byte{7<<5 | 31, 0xff, 0xff, 0xff}},
+		{"huge array", []byte{31, typeArray - 7, 0xff, 0xff, 0xff}},
+		{"array longer than the data", []byte{3, typeArray - 7, 2<<5 | 1, 'a'}},
+		{"short double", []byte{3<<5 | 4, 0, 0, 0, 0}},
+		{"end marker", []byte{0, 13 - 7}},
+	}
+	for _, tt := range tests {
+		db := &mmdb{buf: tt.data}
+		if _, _, err := db.decode(0, 0); !errors.Is(err, errCorrupt) {
+			t.Errorf("%s: decode error = %v, want errCorrupt", tt.name, err)
+		}
+	}
+}
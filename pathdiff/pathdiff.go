@@ -0,0 +1,140 @@
+// Package pathdiff compares the routes taken by two stored traces.
+package pathdiff
+
+import "app/db"
+
+// Kind classifies one TTL of a comparison.
+type Kind string
+
+const (
+	Same    Kind = "same"    // the same router answered in both traces
+	Changed Kind = "changed" // a different router answered
+	Added   Kind = "added"   // a router answered only in the newer trace
+	Removed Kind = "removed" // a router answered only in the older trace
+	Unknown Kind = "unknown" // a probe went unanswered in one of the traces
+)
+
+// HopDiff compares the hops at one TTL.
+type HopDiff struct {
+	TTL         int     `json:"ttl"`
+	Kind        Kind    `json:"kind"`
+	OldIP       string  `json:"oldIp"`
+	OldHostname string  `json:"oldHostname"`
+	NewIP       string  `json:"newIp"`
+	NewHostname string  `json:"newHostname"`
+	OldRTT      float64 `json:"oldRtt"`   // ms, 0 if unanswered
+	NewRTT      float64 `json:"newRtt"`   // ms, 0 if unanswered
+	RTTDelta    float64 `json:"rttDelta"` // NewRTT - OldRTT, 0 unless both answered
+}
+
+// Diff is the hop-by-hop comparison of an older trace with a newer one.
+type Diff struct {
+	FromID      int64     `json:"fromId"`
+	ToID        int64     `json:"toId"`
+	Destination string    `json:"destination"`
+	Changed     bool      `json:"changed"` // any hop added, removed or changed
+	Added       int       `json:"added"`
+	Removed     int       `json:"removed"`
+	Rerouted    int       `json:"rerouted"` // hops of Kind Changed
+	Hops        []HopDiff `json:"hops"`     // in TTL order
+}
+
+// Compare diffs the hops of an older and a newer trace.  A hop counts as
+// the same router when the primary addresses match or, for hops where
+// several routers answered, when the two sets of responders overlap; that
+// keeps per-packet load balancing from being reported as a route change.
+// Unanswered hops prove nothing either way and are reported as Unknown,
+// including those past the end of the other trace, such as the timeouts a
+// trace that never reached its destination ends with.
+func Compare(older, newer []db.HopRecord) Diff {
+	oldByTTL := byTTL(older)
+	newByTTL := byTTL(newer)
+	maxTTL := 0
+	for ttl := range oldByTTL {
+		maxTTL = max(maxTTL, ttl)
+	}
+	for ttl := range newByTTL {
+		maxTTL = max(maxTTL, ttl)
+	}
+
+	var d Diff
+	for ttl := 1; ttl <= maxTTL; ttl++ {
+		o, inOld := oldByTTL[ttl]
+		n, inNew := newByTTL[ttl]
+		if !inOld && !inNew {
+			continue
+		}
+		h := HopDiff{TTL: ttl}
+		if inOld {
+			h.OldIP, h.OldHostname, h.OldRTT = o.IP, o.Hostname, rtt(o)
+		}
+		if inNew {
+			h.NewIP, h.NewHostname, h.NewRTT = n.IP, n.Hostname, rtt(n)
+		}
+
+		switch {
+		case !inOld && n.Success:
+			h.Kind = Added
+			d.Added++
+		case !inNew && o.Success:
+			h.Kind = Removed
+			d.Removed++
+		case !inOld || !inNew || !o.Success || !n.Success:
+			h.Kind = Unknown
+		case sameRouter(o, n):
+			h.Kind = Same
+		default:
+			h.Kind = Changed
+			d.Rerouted++
+		}
+		if inOld && inNew && o.Success && n.Success {
+			h.RTTDelta = h.NewRTT - h.OldRTT
+		}
+		d.Hops = append(d.Hops, h)
+	}
+	d.Changed = d.Added+d.Removed+d.Rerouted > 0
+	return d
+}
+
+func byTTL(hops []db.HopRecord) map[int]db.HopRecord {
+	m := make(map[int]db.HopRecord, len(hops))
+	for _, h := range hops {
+		m[h.TTL] = h
+	}
+	return m
+}
+
+// rtt is the hop's average RTT, or its single RTT for hops stored without
+// statistics.
+func rtt(h db.HopRecord) float64 {
+	if !h.Success {
+		return 0
+	}
+	if h.AvgRTT > 0 {
+		return h.AvgRTT
+	}
+	return h.RTT
+}
+
+func sameRouter(a, b db.HopRecord) bool {
+	if a.IP == "" || b.IP == "" {
+		// Imported mtr reports may name a hop without its address.
+		return a.IP == b.IP && a.Hostname == b.Hostname
+	}
+	if a.IP == b.IP {
+		return true
+	}
+	seen := map[string]bool{a.IP: true}
+	for _, r := range a.Responders {
+		seen[r.IP] = true
+	}
+	if seen[b.IP] {
+		return true
+	}
+	for _, r := range b.Responders {
+		if seen[r.IP] {
+			return true
+		}
+	}
+	return false
+}
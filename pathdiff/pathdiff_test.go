@@ -0,0 +1,160 @@
+package pathdiff
+
+import (
+	"testing"
+
+	"app/db"
+)
+
+// hop is an answered hop at ttl, or an unanswered one when ip is "".
+func hop(ttl int, ip string, rtt float64, responders ...string) db.HopRecord {
+	h := db.HopRecord{TTL: ttl, IP: ip, Success: ip != "", RTT: rtt}
+	for _, r := range responders {
+		h.Responders = append(h.Responders, db.ResponderRecord{IP: r, Count: 1})
+	}
+	return h
+}
+
+// path is a trace answering at every TTL from 1, one router per address.
+func path(ips ...string) []db.HopRecord {
+	hops := make([]db.HopRecord, len(ips))
+	for i, ip := range ips {
+		hops[i] = hop(i+1, ip, float64(i+1))
+	}
+	return hops
+}
+
+// timeouts appends unanswered hops to hops up to and including maxTTL.
+func timeouts(hops []db.HopRecord, maxTTL int) []db.HopRecord {
+	for ttl := len(hops) + 1; ttl <= maxTTL; ttl++ {
+		hops = append(hops, hop(ttl, "", 0))
+	}
+	return hops
+}
+
+func TestCompare(t *testing.T) {
+	reached := path("10.0.0.1", "192.0.2.1", "198.51.100.1", "198.51.100.2",
+		"203.0.113.1", "203.0.113.2", "203.0.113.3", "203.0.113.4",
+		"203.0.113.5", "203.0.113.6", "203.0.113.7")
+	lost := timeouts(path("10.0.0.1", "192.0.2.1", "198.51.100.1"), 30)
+
+	tests := []struct {
+		name                     string
+		older, newer             []db.HopRecord
+		changed                  bool
+		added, removed, rerouted int
+		kinds                    map[int]Kind // by TTL; unlisted TTLs are not checked
+	}{
+		{
+			name:    "same",
+			older:   path("10.0.0.1", "192.0.2.1", "203.0.113.1"),
+			newer:   path("10.0.0.1", "192.0.2.1", "203.0.113.1"),
+			changed: false,
+			kinds:   map[int]Kind{1: Same, 2: Same, 3: Same},
+		},
+		{
+			name:     "rerouted",
+			older:    path("10.0.0.1", "192.0.2.1", "203.0.113.1"),
+			newer:    path("10.0.0.1", "198.51.100.1", "203.0.113.1"),
+			changed:  true,
+			rerouted: 1,
+			kinds:    map[int]Kind{1: Same, 2: Changed, 3: Same},
+		},
+		{
+			name: "load balanced",
+			older: []db.HopRecord{
+				hop(1, "10.0.0.1", 1),
+				hop(2, "192.0.2.1", 2, "192.0.2.1", "192.0.2.2"),
+			},
+			newer: []db.HopRecord{
+				hop(1, "10.0.0.1", 1),
+				hop(2, "192.0.2.2", 2, "192.0.2.2", "192.0.2.3"),
+			},
+			changed: false,
+			kinds:   map[int]Kind{2: Same},
+		},
+		{
+			name:    "unanswered in one trace",
+			older:   path("10.0.0.1", "192.0.2.1", "203.0.113.1"),
+			newer:   []db.HopRecord{hop(1, "10.0.0.1", 1), hop(2, "", 0), hop(3, "203.0.113.1", 3)},
+			changed: false,
+			kinds:   map[int]Kind{2: Unknown},
+		},
+		{
+			name:    "longer path",
+			older:   path("10.0.0.1", "203.0.113.1"),
+			newer:   path("10.0.0.1", "192.0.2.1", "203.0.113.1"),
+			changed: true,
+			added:   1,
+			// The destination moved to TTL 3, so TTL 2 changed too.
+			rerouted: 1,
+			kinds:    map[int]Kind{2: Changed, 3: Added},
+		},
+		{
+			name:     "shorter path",
+			older:    path("10.0.0.1", "192.0.2.1", "203.0.113.1"),
+			newer:    path("10.0.0.1", "203.0.113.1"),
+			changed:  true,
+			removed:  1,
+			rerouted: 1,
+			kinds:    map[int]Kind{2: Changed, 3: Removed},
+		},
+		{
+			// A trace that timed out up to MaxHops ends with a run of
+			// unanswered TTLs the other trace never probed.
+			name:    "reached at TTL 11 after MaxHops",
+			older:   lost,
+			newer:   reached,
+			changed: false,
+			kinds:   map[int]Kind{3: Same, 4: Unknown, 11: Unknown, 12: Unknown, 30: Unknown},
+		},
+		{
+			name:    "MaxHops after reached at TTL 11",
+			older:   reached,
+			newer:   lost,
+			changed: false,
+			kinds:   map[int]Kind{3: Same, 4: Unknown, 11: Unknown, 12: Unknown, 30: Unknown},
+		},
+		{
+			name:    "imported hops without addresses",
+			older:   []db.HopRecord{{TTL: 1, Hostname: "gw.example", Success: true}},
+			newer:   []db.HopRecord{{TTL: 1, Hostname: "gw.example", Success: true}},
+			changed: false,
+			kinds:   map[int]Kind{1: Same},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Compare(tt.older, tt.newer)
+			if d.Changed != tt.changed {
+				t.Errorf("Changed = %v, want %v", d.Changed, tt.changed)
+			}
+			if d.Added != tt.added || d.Removed != tt.removed || d.Rerouted != tt.rerouted {
+				t.Errorf("added/removed/rerouted = %d/%d/%d, want %d/%d/%d",
+					d.Added, d.Removed, d.Rerouted, tt.added, tt.removed, tt.rerouted)
+			}
+			got := map[int]Kind{}
+			for _, h := range d.Hops {
+				got[h.TTL] = h.Kind
+			}
+			for ttl, want := range tt.kinds {
+				if got[ttl] != want {
+					t.Errorf("TTL %d: kind = %q, want %q", ttl, got[ttl], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareRTTDelta(t *testing.T) {
+	older := []db.HopRecord{hop(1, "10.0.0.1", 1), {TTL: 2, IP: "192.0.2.1", Success: true, RTT: 9, AvgRTT: 10}}
+	newer := []db.HopRecord{hop(1, "10.0.0.1", 1), {TTL: 2, IP: "192.0.2.1", Success: true, AvgRTT: 14.5}}
+	d := Compare(older, newer)
+	if len(d.Hops) != 2 {
+		t.Fatalf("got %d hops, want 2", len(d.Hops))
+	}
+	if h := d.Hops[1]; h.OldRTT != 10 || h.NewRTT != 14.5 || h.RTTDelta != 4.5 {
+		t.Errorf("TTL 2 RTTs = %v -> %v (delta %v), want 10 -> 14.5 (delta 4.5)", h.OldRTT, h.NewRTT, h.RTTDelta)
+	}
+}
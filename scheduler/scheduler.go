@@ -0,0 +1,196 @@
+// Package scheduler runs the recurring traces stored as schedules in the
+// history database.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"app/db"
+)
+
+// DefaultConcurrency is how many scheduled traces may run at once.
+const DefaultConcurrency = 2
+
+// checkInterval is how often schedules are checked for being due.  Changes
+// made through the app call Wake, so this only bounds how late a run starts,
+// or how late a deleted schedule's trace is cancelled.
+const checkInterval = 15 * time.Second
+
+// RunFunc runs and saves one trace for a schedule.  It returns the ID of the
+// saved trace, or 0 if nothing was saved.
+type RunFunc func(ctx context.Context, s db.ScheduleRecord) (int64, error)
+
+// Scheduler starts each schedule's trace once its interval has passed since
+// the previous run, never running more than a fixed number at once.
+type Scheduler struct {
+	db   *db.DB
+	run  RunFunc
+	slot chan struct{} // one token per trace allowed to run
+	wake chan struct{}
+
+	mu      sync.Mutex
+	active  map[int64]context.CancelFunc // cancels each schedule queued or running
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+	onError func(error)
+
+	now   func() time.Time // the clock schedules are due by
+	every time.Duration    // checkInterval, but for tests
+}
+
+// New returns a scheduler for the schedules in d that runs them with run,
+// at most concurrency at a time.  Values below 1 mean DefaultConcurrency.
+// onError, if non-nil, is told about failures to read or update schedules.
+func New(d *db.DB, run RunFunc, concurrency int, onError func(error)) *Scheduler {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	return &Scheduler{
+		db:      d,
+		run:     run,
+		slot:    make(chan struct{}, concurrency),
+		wake:    make(chan struct{}, 1),
+		active:  map[int64]context.CancelFunc{},
+		onError: onError,
+		now:     time.Now,
+		every:   checkInterval,
+	}
+}
+
+// Start checks for due schedules in the background until ctx is cancelled
+// or Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ticker := time.NewTicker(s.every)
+		defer ticker.Stop()
+		for {
+			s.dispatch(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Stop cancels any traces in progress and waits for them to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.running.Wait()
+}
+
+// Wake makes the scheduler re-read its schedules now, so that a new or
+// resumed schedule runs, or a deleted one's trace is cancelled, without
+// waiting for the next check.
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts every schedule that is due and not already queued, and
+// cancels the traces of schedules that have been deleted.
+func (s *Scheduler) dispatch(ctx context.Context) {
+	schedules, err := s.db.ListSchedules()
+	if err != nil {
+		s.report(err)
+		return
+	}
+	listed := map[int64]bool{}
+	now := s.now()
+	for _, sched := range schedules {
+		listed[sched.ID] = true
+		if sched.Paused || !due(sched, now) {
+			continue
+		}
+		s.mu.Lock()
+		if s.active[sched.ID] != nil {
+			s.mu.Unlock()
+			continue
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		s.active[sched.ID] = cancel
+		s.mu.Unlock()
+
+		s.running.Add(1)
+		go s.runOne(runCtx, sched)
+	}
+
+	s.mu.Lock()
+	for id, cancel := range s.active {
+		if !listed[id] {
+			cancel()
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) runOne(ctx context.Context, sched db.ScheduleRecord) {
+	defer s.running.Done()
+	defer func() {
+		s.mu.Lock()
+		s.active[sched.ID]() // release the run's context
+		delete(s.active, sched.ID)
+		s.mu.Unlock()
+	}()
+
+	select {
+	case s.slot <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-s.slot }()
+	if ctx.Err() != nil {
+		return // cancelled as the slot came free
+	}
+
+	started := s.now()
+	traceID, err := s.run(ctx, sched)
+	if ctx.Err() != nil {
+		// Shut down or deleted mid-run; try again next time rather than
+		// record it.
+		return
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if err := s.db.RecordScheduleRun(sched.ID, started, traceID, msg); err != nil {
+		s.report(err)
+	}
+}
+
+func (s *Scheduler) report(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// due reports whether a schedule's interval has passed since it last ran.
+func due(s db.ScheduleRecord, now time.Time) bool {
+	if s.LastRunAt == "" {
+		return true
+	}
+	last, err := time.Parse(time.RFC3339, s.LastRunAt)
+	if err != nil {
+		return true
+	}
+	return !now.Before(last.Add(time.Duration(s.IntervalMinutes) * time.Minute))
+}
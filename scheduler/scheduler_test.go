@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"app/db"
+)
+
+// clock is a manually advanced time source for Scheduler.now.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestScheduler starts a scheduler running schedules from a new database
+// with run, checking every few milliseconds by a clock the test advances.
+func newTestScheduler(t *testing.T, run RunFunc) (*Scheduler, *db.DB, *clock) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir) // Linux and BSDs
+	t.Setenv("HOME", dir)            // macOS
+	t.Setenv("AppData", dir)         // Windows
+	d, err := db.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	c := &clock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	s := New(d, run, 2, func(err error) { t.Error(err) })
+	s.now = c.now
+	s.every = 5 * time.Millisecond
+	s.Start(context.Background())
+	t.Cleanup(s.Stop)
+	return s, d, c
+}
+
+func createSchedule(t *testing.T, d *db.DB, destination string, intervalMinutes int) int64 {
+	t.Helper()
+	id, err := d.CreateSchedule(destination, intervalMinutes, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// receive waits for a value from ch.
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+// quiet fails if anything arrives on ch for a while.
+func quiet[T any](t *testing.T, ch <-chan T, what string) {
+	t.Helper()
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected %s: %v", what, v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRunsOnInterval(t *testing.T) {
+	ran := make(chan int64, 10)
+	s, d, c := newTestScheduler(t, func(ctx context.Context, sched db.ScheduleRecord) (int64, error) {
+		ran <- sched.ID
+		return 0, nil
+	})
+
+	id := createSchedule(t, d, "example.com", 5)
+	s.Wake()
+	// A schedule that has never run is due straight away, then every five
+	// minutes from when it last started.
+	if got := receive(t, ran, "the first run"); got != id {
+		t.Fatalf("ran schedule %d, want %d", got, id)
+	}
+	quiet(t, ran, "run before the interval passed")
+	c.advance(5*time.Minute - time.Second)
+	quiet(t, ran, "run a second early")
+	c.advance(time.Second)
+	receive(t, ran, "the run after five minutes")
+	quiet(t, ran, "second run for the same interval")
+
+	scheds, err := d.ListSchedules()
+	if err != nil || len(scheds) != 1 {
+		t.Fatalf("ListSchedules = %v, %v", scheds, err)
+	}
+	if want := c.now().Format(time.RFC3339); scheds[0].LastRunAt != want {
+		t.Errorf("last run at %s, want %s", scheds[0].LastRunAt, want)
+	}
+
+	// Paused schedules wait however long it has been.
+	if err := d.SetSchedulePaused(id, true); err != nil {
+		t.Fatal(err)
+	}
+	c.advance(time.Hour)
+	quiet(t, ran, "run while paused")
+	if err := d.SetSchedulePaused(id, false); err != nil {
+		t.Fatal(err)
+	}
+	s.Wake()
+	receive(t, ran, "the run after resuming")
+}
+
+// blockingRun returns a RunFunc that reports each schedule it starts on
+// started and then waits for its context to be cancelled, which it reports
+// on cancelled.
+func blockingRun(started, cancelled chan<- int64) RunFunc {
+	return func(ctx context.Context, sched db.ScheduleRecord) (int64, error) {
+		started <- sched.ID
+		<-ctx.Done()
+		cancelled <- sched.ID
+		return 0, ctx.Err()
+	}
+}
+
+func TestStopCancelsRuns(t *testing.T) {
+	started, cancelled := make(chan int64, 10), make(chan int64, 10)
+	s, d, _ := newTestScheduler(t, blockingRun(started, cancelled))
+	createSchedule(t, d, "example.com", 5)
+	createSchedule(t, d, "example.net", 5)
+	s.Wake()
+	receive(t, started, "a run")
+	receive(t, started, "a second run")
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	receive(t, stopped, "Stop to return")
+	if len(cancelled) != 2 {
+		t.Errorf("%d runs cancelled, want 2", len(cancelled))
+	}
+
+	// A cancelled run is not recorded, so it runs again next time.
+	scheds, err := d.ListSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sched := range scheds {
+		if sched.LastRunAt != "" {
+			t.Errorf("schedule %d recorded a run at %s", sched.ID, sched.LastRunAt)
+		}
+	}
+}
+
+func TestDeleteCancelsRun(t *testing.T) {
+	started, cancelled := make(chan int64, 10), make(chan int64, 10)
+	s, d, _ := newTestScheduler(t, blockingRun(started, cancelled))
+	deleted := createSchedule(t, d, "example.com", 5)
+	createSchedule(t, d, "example.net", 5)
+	s.Wake()
+	receive(t, started, "a run")
+	receive(t, started, "a second run")
+
+	if err := d.DeleteSchedule(deleted); err != nil {
+		t.Fatal(err)
+	}
+	s.Wake()
+	if got := receive(t, cancelled, "the deleted schedule's run to be cancelled"); got != deleted {
+		t.Errorf("cancelled schedule %d, want %d", got, deleted)
+	}
+	quiet(t, cancelled, "cancellation of the kept schedule")
+	quiet(t, started, "run of the deleted schedule")
+}
+
+func TestRunsDoNotOverlap(t *testing.T) {
+	var running, most, runs atomic.Int32
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	s, d, c := newTestScheduler(t, func(ctx context.Context, sched db.ScheduleRecord) (int64, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		runs.Add(1)
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return 0, nil
+	})
+
+	createSchedule(t, d, "example.com", 1)
+	s.Wake()
+	receive(t, started, "the first run")
+	// Several intervals pass while the first run is still going.
+	for range 5 {
+		c.advance(time.Minute)
+		s.Wake()
+		quiet(t, started, "overlapping run")
+	}
+	release <- struct{}{}
+	// The run finishing late does not queue up the ones it overran.
+	c.advance(time.Minute)
+	receive(t, started, "the next run")
+	quiet(t, started, "run catching up")
+	close(release)
+
+	if n := most.Load(); n != 1 {
+		t.Errorf("%d runs of one schedule at once", n)
+	}
+	if n := runs.Load(); n != 2 {
+		t.Errorf("%d runs, want 2", n)
+	}
+}
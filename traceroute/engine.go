@@ -1,13 +1,21 @@
-// Package traceroute runs the system traceroute binary and streams parsed hops.
+// Package traceroute probes the path to a host and streams the hops found.
 //
-// Parallel probing (PingPlotter-style): one traceroute process is launched per
-// TTL, all concurrently, each with -f N -m N so it probes exactly that one
-// hop and exits.  Results arrive out of order and are forwarded immediately to
-// the caller's hops channel.
+// Parallel probing (PingPlotter-style): every TTL is probed concurrently and
+// results are forwarded to the caller's hops channel as they arrive, out of
+// order.
 //
-// On macOS and Linux, /usr/sbin/traceroute (or /usr/bin/traceroute) already
-// carries the setuid-root bit set by the OS vendor, so no additional
-// privileges are required from the calling process.
+// Each TTL is probed through a Prober (see prober.go), chosen with
+// Options.Method.  The preferred backend is a native ICMP Echo prober that sets
+// the TTL on each probe itself and matches Time Exceeded / Echo Reply
+// messages back to it.  It needs a raw ICMP socket (root or CAP_NET_RAW on
+// Linux, administrator on Windows); macOS also allows unprivileged ICMP
+// datagram sockets.
+//
+// When no ICMP socket can be opened (or MethodExec is asked for) we shell out
+// to the system traceroute binary instead: one process per TTL, each with -f N -m N so it probes
+// exactly that one hop and exits.  On macOS and Linux, /usr/sbin/traceroute
+// (or /usr/bin/traceroute) already carries the setuid-root bit set by the OS
+// vendor, so no additional privileges are required from the calling process.
 // On Windows, tracert does not support -f/-m in a useful parallel way, so we
 // fall back to the classic sequential approach there.
 package traceroute
@@ -31,16 +39,132 @@ type Hop struct {
 	TTL       int     `json:"ttl"`
 	IP        string  `json:"ip"`
 	Hostname  string  `json:"hostname"`
-	RTT       float64 `json:"rtt"` // milliseconds, first probe
+	RTT       float64 `json:"rtt"` // milliseconds, first answered probe
 	Success   bool    `json:"success"`
 	IsFinal   bool    `json:"isFinal"`
 	IsTimeout bool    `json:"isTimeout"`
+	PortState string  `json:"portState"` // PortOpen / PortClosed for MethodTCP destination hops
+
+	// Statistics over the Options.Probes probes sent for this TTL.  RTTs are
+	// in milliseconds over the answered probes; Loss is a percentage.
+	Sent      int     `json:"sent"`
+	Received  int     `json:"received"`
+	Loss      float64 `json:"loss"`
+	MinRTT    float64 `json:"minRtt"`
+	AvgRTT    float64 `json:"avgRtt"`
+	MaxRTT    float64 `json:"maxRtt"`
+	StdDevRTT float64 `json:"stdDevRtt"`
+	Jitter    float64 `json:"jitter"` // mean difference between consecutive RTTs
+
+	// Responders lists every distinct address that answered for this TTL,
+	// most frequent first.  More than one means the path fans out here
+	// (equal-cost multipath load balancing) or changed between probes.
+	Responders []Responder `json:"responders"`
+
+	// The autonomous system announcing IP, as found by an Enricher; zero
+	// when unknown.  ASBoundary marks the first hop into a different AS
+	// (see MarkASBoundaries).
+	ASN        int    `json:"asn"`
+	ASName     string `json:"asName"`
+	ASBoundary bool   `json:"asBoundary"`
+
+	// Where IP is, as found by a GeoIP Enricher; empty when unknown.
+	CountryCode string  `json:"countryCode"` // ISO 3166-1 alpha-2
+	Country     string  `json:"country"`
+	City        string  `json:"city"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+
+	// MPLS is the label stack the router reported receiving the probe with
+	// (RFC 4950), outermost label first.  Only native probers read it, and
+	// only routers inside an MPLS tunnel send one.
+	MPLS []MPLSLabel `json:"mpls"`
+}
+
+// Responder is one address that answered probes for a TTL, with statistics
+// over the probes it answered.
+type Responder struct {
+	IP       string  `json:"ip"`
+	Hostname string  `json:"hostname"`
+	Count    int     `json:"count"`
+	MinRTT   float64 `json:"minRtt"`
+	AvgRTT   float64 `json:"avgRtt"`
+	MaxRTT   float64 `json:"maxRtt"`
+}
+
+// MPLSLabel is one entry of an MPLS label stack.
+type MPLSLabel struct {
+	Label int  `json:"label"`
+	TC    int  `json:"tc"` // traffic class, formerly EXP
+	S     bool `json:"s"`  // bottom of stack
+	TTL   int  `json:"ttl"`
 }
 
+// Port states reported on the destination hop of a TCP trace.
+const (
+	PortOpen   = "open"   // destination answered with SYN-ACK
+	PortClosed = "closed" // destination answered with RST
+)
+
 // Options configures a traceroute run.
 type Options struct {
-	MaxHops   int
-	TimeoutMs int
+	MaxHops   int `json:"maxHops"`
+	TimeoutMs int `json:"timeoutMs"`
+	Probes    int `json:"probes"` // probes per TTL; values below 1 mean 1
+
+	// IPVersion forces IPv4 (4) or IPv6 (6) for dual-stack hosts.  Zero
+	// prefers IPv4 and falls back to IPv6 when the host has no A record.
+	IPVersion int `json:"ipVersion"`
+
+	// Continuous keeps probing every TTL, one probe per round and one round
+	// every IntervalMs (DefaultIntervalMs when zero), sending cumulative
+	// statistics after each probe until the context is cancelled.  Probes
+	// is ignored in this mode.
+	Continuous bool `json:"continuous"`
+	IntervalMs int  `json:"intervalMs"`
+
+	// Method selects the probing backend; the zero value is MethodAuto.
+	Method Method `json:"method"`
+	// Port is the first destination port for MethodUDP (DefaultUDPPort when
+	// zero); every probe moves on to the next port.  PortRange bounds how
+	// many ports are used before wrapping back to Port (0 = up to 65535);
+	// it must be at least MaxHops, as every TTL has a probe in flight.
+	// For MethodTCP, Port is the single port probed (DefaultTCPPort when
+	// zero) and PortRange is ignored.
+	Port      int `json:"port"`
+	PortRange int `json:"portRange"`
+
+	// Paris keeps the flow identifier constant across probes (see paris.go)
+	// so per-flow load balancers send every TTL down the same path.  It
+	// applies to MethodICMP and MethodUDP; for UDP, Port is then the fixed
+	// destination port of flow zero.  FlowID selects the flow; Flows > 1
+	// cycles each TTL's probes through that many consecutive flows to
+	// enumerate alternate paths.
+	Paris  bool `json:"paris"`
+	FlowID int  `json:"flowId"`
+	Flows  int  `json:"flows"`
+
+	// Prober, when non-nil, overrides Method.  The caller keeps ownership
+	// and is responsible for closing it.
+	Prober Prober `json:"-"`
+
+	// Enrichers annotate every hop, in order, before it is sent.
+	Enrichers []Enricher `json:"-"`
+
+	// Reverse DNS.  Hostnames come from Resolver (a process-wide one when
+	// nil), which asks DNSServer ("host" or "host:port"; the system
+	// resolver when empty) and gives up after DNSTimeoutMs
+	// (DefaultDNSTimeoutMs when zero).
+	DNSServer    string    `json:"dnsServer"`
+	DNSTimeoutMs int       `json:"dnsTimeoutMs"`
+	Resolver     *Resolver `json:"-"`
+
+	// OnHostname, when set, stops hops waiting for their names: a hop whose
+	// address is not cached is sent without its hostname, and OnHostname is
+	// called once the name is known.  That applies to hop.IP and to any
+	// responder at that address.  It is called from other goroutines, but
+	// always before Run returns.
+	OnHostname func(ttl int, ip, hostname string) `json:"-"`
 }
 
 // DefaultOptions returns sensible defaults.
@@ -48,6 +172,7 @@ func DefaultOptions() *Options {
 	return &Options{
 		MaxHops:   30,
 		TimeoutMs: 1000,
+		Probes:    DefaultProbes,
 	}
 }
 
@@ -55,35 +180,52 @@ func DefaultOptions() *Options {
 // reaching the destination.
 var ErrMaxHopsReached = fmt.Errorf("max hops reached")
 
-// Run executes parallel per-TTL traceroute probes on Unix, or a single
-// sequential traceroute on Windows.  Hops are sent to the hops channel as
-// they arrive; the channel is NOT closed by this function.
+// Run executes parallel per-TTL probes using the backend selected by
+// opts.Method (or opts.Prober, when set).  On Windows the exec backend runs a
+// single sequential tracert instead, since tracert cannot probe one TTL at a
+// time.  With opts.Continuous it keeps probing until ctx is cancelled and
+// returns nil.  Hops are sent to the hops channel as they arrive, after
+// passing through opts.Enrichers; the channel is NOT closed by this function.
 func Run(ctx context.Context, dest string, opts *Options, hops chan<- Hop) error {
 	if opts == nil {
 		opts = DefaultOptions()
 	}
-
-	if runtime.GOOS == "windows" {
-		return runSequential(ctx, dest, opts, hops)
+	if len(opts.Enrichers) > 0 {
+		in, wait := enrichStage(opts.Enrichers, hops)
+		defer wait()
+		hops = in
 	}
-	return runParallel(ctx, dest, opts, hops)
-}
-
-// ── Parallel implementation (macOS / Linux) ──────────────────────────────────
-
-func runParallel(ctx context.Context, dest string, opts *Options, hops chan<- Hop) error {
-	binary, err := tracerouteBinary()
-	if err != nil {
-		return err
+	names := newHostnames(ctx, opts)
+	defer names.wait()
+
+	prober := opts.Prober
+	if prober == nil {
+		p, err := NewProber(dest, opts)
+		if err == errSequentialOnly {
+			if opts.Continuous {
+				return errNoContinuous
+			}
+			return runSequential(ctx, dest, opts, hops, names)
+		}
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		prober = p
 	}
-
-	timeoutSecs := opts.TimeoutMs / 1000
-	if timeoutSecs < 1 {
-		timeoutSecs = 1
+	if opts.Continuous {
+		return runMonitor(ctx, dest, opts, hops, prober, names)
 	}
+	return runProbes(ctx, dest, opts, hops, prober, names)
+}
 
-	destIPs := resolveIPs(dest)
-	destIP := resolveIP(dest)
+// ── Parallel implementation ──────────────────────────────────────────────────
+
+// runProbes probes every TTL up to opts.MaxHops concurrently and forwards the
+// summarised results to hops, holding back the destination hop until every
+// probe has finished so that only the lowest TTL reaching it is emitted.
+func runProbes(ctx context.Context, dest string, opts *Options, hops chan<- Hop, prober Prober, names *hostnames) error {
+	destIPs := resolveIPs(dest, opts.IPVersion)
 
 	// lowestFinalTTL: once any goroutine confirms the destination, this is set
 	// to the lowest TTL that reached it. Goroutines with a higher TTL discard
@@ -108,32 +250,7 @@ func runParallel(ctx context.Context, dest string, opts *Options, hops chan<- Ho
 		go func(ttl int) {
 			defer wg.Done()
 
-			args := []string{
-				"-f", strconv.Itoa(ttl),
-				"-m", strconv.Itoa(ttl),
-				"-q", "1",
-				"-w", strconv.Itoa(timeoutSecs),
-				"-n",
-				dest,
-			}
-			cmd := exec.CommandContext(ctx, binary, args...)
-			out, _ := cmd.Output()
-
-			var hop Hop
-			for _, line := range strings.Split(string(out), "\n") {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "traceroute") {
-					continue
-				}
-				if h, ok := parseUnixLine(line, destIP); ok {
-					hop = h
-					break
-				}
-			}
-
-			if hop.TTL == 0 {
-				hop = Hop{TTL: ttl, Success: false, IsTimeout: true}
-			}
+			hop := probeTTL(ctx, prober, ttl, opts)
 
 			// Reached the destination: stash it and update lowestFinalTTL.
 			// Do NOT emit yet — we wait until wg.Wait() to pick the true lowest.
@@ -158,12 +275,7 @@ func runParallel(ctx context.Context, dest string, opts *Options, hops chan<- Ho
 				return
 			}
 
-			// Async reverse-DNS.
-			if hop.Success && hop.Hostname == "" && hop.IP != "" {
-				if names, err := net.LookupAddr(hop.IP); err == nil && len(names) > 0 {
-					hop.Hostname = strings.TrimSuffix(names[0], ".")
-				}
-			}
+			names.fill(&hop)
 
 			select {
 			case hops <- hop:
@@ -177,12 +289,7 @@ func runParallel(ctx context.Context, dest string, opts *Options, hops chan<- Ho
 	// Emit the single destination hop with the lowest TTL.
 	if best, ok := finalHops[int(lowestFinalTTL.Load())]; ok {
 		best.IsFinal = true
-		// Async reverse-DNS for the destination hop.
-		if best.Hostname == "" && best.IP != "" {
-			if names, err := net.LookupAddr(best.IP); err == nil && len(names) > 0 {
-				best.Hostname = strings.TrimSuffix(names[0], ".")
-			}
-		}
+		names.fill(&best)
 		select {
 		case hops <- best:
 		case <-ctx.Done():
@@ -200,26 +307,31 @@ func runParallel(ctx context.Context, dest string, opts *Options, hops chan<- Ho
 
 // ── Sequential implementation (Windows / fallback) ───────────────────────────
 
-func runSequential(ctx context.Context, dest string, opts *Options, hops chan<- Hop) error {
+func runSequential(ctx context.Context, dest string, opts *Options, hops chan<- Hop, names *hostnames) error {
 	timeoutSecs := opts.TimeoutMs / 1000
 	if timeoutSecs < 1 {
 		timeoutSecs = 1
 	}
 
+	// Hand the binary an address rather than the name, so that it traces
+	// the same family we resolved.
+	destIP := resolveIP(dest, opts.IPVersion)
+	v6 := strings.Contains(destIP, ":")
+
 	var binary string
 	var args []string
 
 	switch runtime.GOOS {
 	case "windows":
 		binary = "tracert"
-		args = []string{"-h", strconv.Itoa(opts.MaxHops), "-w", strconv.Itoa(opts.TimeoutMs), dest}
+		args = []string{"-h", strconv.Itoa(opts.MaxHops), "-w", strconv.Itoa(opts.TimeoutMs), destIP}
 	default:
-		b, err := tracerouteBinary()
+		b, familyArgs, err := tracerouteBinary(v6)
 		if err != nil {
 			return err
 		}
 		binary = b
-		args = []string{"-m", strconv.Itoa(opts.MaxHops), "-w", strconv.Itoa(timeoutSecs), "-q", "1", dest}
+		args = append(familyArgs, "-m", strconv.Itoa(opts.MaxHops), "-w", strconv.Itoa(timeoutSecs), "-q", "1", destIP)
 	}
 
 	cmd := exec.CommandContext(ctx, binary, args...)
@@ -231,7 +343,6 @@ func runSequential(ctx context.Context, dest string, opts *Options, hops chan<-
 		return err
 	}
 
-	destIP := resolveIP(dest)
 	reachedDest := false
 	lastTTL := 0
 
@@ -257,6 +368,7 @@ func runSequential(ctx context.Context, dest string, opts *Options, hops chan<-
 		if !ok {
 			continue
 		}
+		names.fill(&hop)
 		hops <- hop
 		if hop.TTL > lastTTL {
 			lastTTL = hop.TTL
@@ -276,64 +388,132 @@ func runSequential(ctx context.Context, dest string, opts *Options, hops chan<-
 
 // ── Helpers ───────────────────────────────────────────────────────────────────
 
-func tracerouteBinary() (string, error) {
+// tracerouteBinary returns the traceroute binary for the platform and family,
+// plus any arguments needed to select that family.
+func tracerouteBinary(v6 bool) (string, []string, error) {
 	switch runtime.GOOS {
 	case "darwin":
-		return "/usr/sbin/traceroute", nil
+		if v6 {
+			return "/usr/sbin/traceroute6", nil, nil
+		}
+		return "/usr/sbin/traceroute", nil, nil
 	case "linux":
+		if v6 {
+			// traceroute6 is usually a symlink to traceroute; otherwise the
+			// modern traceroute takes -6 (inetutils' cannot trace IPv6).
+			for _, p := range []string{"/usr/bin/traceroute6", "/usr/sbin/traceroute6"} {
+				if _, err := exec.LookPath(p); err == nil {
+					return p, nil, nil
+				}
+			}
+			if p, err := exec.LookPath("traceroute6"); err == nil {
+				return p, nil, nil
+			}
+		}
+		var familyArgs []string
+		if v6 {
+			familyArgs = []string{"-6"}
+		}
 		for _, p := range []string{"/usr/bin/traceroute", "/usr/sbin/traceroute"} {
 			if _, err := exec.LookPath(p); err == nil {
-				return p, nil
+				return p, familyArgs, nil
 			}
 		}
 		if p, err := exec.LookPath("traceroute"); err == nil {
-			return p, nil
+			return p, familyArgs, nil
 		}
-		return "", fmt.Errorf("traceroute binary not found; install inetutils-traceroute or traceroute")
+		return "", nil, fmt.Errorf("traceroute binary not found; install inetutils-traceroute or traceroute")
 	default:
-		return "", fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+		return "", nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
 }
 
-// resolveIPs returns all IPv4 addresses for a host as a set.
-// If the host is already an IP, returns a set containing just that IP.
-func resolveIPs(host string) map[string]bool {
-	set := map[string]bool{}
+// resolveAddrs returns the addresses of host in the family selected by
+// version (see Options.IPVersion), in resolver order.  If host is already an
+// IP it is returned as is, provided it is of that family.
+func resolveAddrs(host string, version int) []net.IP {
+	var all []net.IP
 	if ip := net.ParseIP(host); ip != nil {
-		set[ip.String()] = true
-		return set
-	}
-	addrs, err := net.LookupHost(host)
-	if err != nil {
-		return set
+		all = []net.IP{ip}
+	} else if addrs, err := net.LookupHost(host); err == nil {
+		for _, a := range addrs {
+			if ip := net.ParseIP(a); ip != nil {
+				all = append(all, ip)
+			}
+		}
 	}
-	for _, a := range addrs {
-		if ip := net.ParseIP(a); ip != nil && ip.To4() != nil {
-			set[a] = true
+
+	var v4, v6 []net.IP
+	for _, ip := range all {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
 		}
 	}
+	switch version {
+	case 4:
+		return v4
+	case 6:
+		return v6
+	}
+	if len(v4) > 0 {
+		return v4
+	}
+	return v6
+}
+
+// resolveIPs returns the addresses of host (see resolveAddrs) as a set of
+// canonical strings.
+func resolveIPs(host string, version int) map[string]bool {
+	set := map[string]bool{}
+	for _, ip := range resolveAddrs(host, version) {
+		set[ip.String()] = true
+	}
 	return set
 }
 
-// resolveIP returns the first IPv4 address for display / single-comparison use.
-func resolveIP(host string) string {
-	set := resolveIPs(host)
-	for ip := range set {
-		return ip
+// ResolveDest returns the address a trace to dest probes, or "" if dest has
+// none in the family selected by ipVersion (see Options.IPVersion).
+func ResolveDest(dest string, ipVersion int) string {
+	if addrs := resolveAddrs(dest, ipVersion); len(addrs) > 0 {
+		return addrs[0].String()
+	}
+	return ""
+}
+
+// resolveIP returns the first address for display / single-comparison use,
+// or host itself if it cannot be resolved.
+func resolveIP(host string, version int) string {
+	if addrs := resolveAddrs(host, version); len(addrs) > 0 {
+		return addrs[0].String()
 	}
 	return host
 }
 
+// canonicalIP rewrites an address as printed by a traceroute binary into the
+// form net.IP.String produces, so IPv6 addresses compare equal however they
+// were written.
+func canonicalIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
 // ── Line parsers ──────────────────────────────────────────────────────────────
 
 // With -n flag, output is always numeric, so hostname group won't appear.
 // Patterns we handle:
 //
 //	" 1  192.168.1.1  3.224 ms"          (numeric only, -n)
+//	" 1  2001:db8::1  3.224 ms"          (traceroute6, numeric only)
 //	" 1  host.example (1.2.3.4)  3 ms"   (with hostname, no -n)
 //	" 1  *"
-var reUnixHopNumeric = regexp.MustCompile(`^\s*(\d+)\s+(\d+\.\d+\.\d+\.\d+)\s+([\d.]+)\s+ms`)
-var reUnixHopNamed = regexp.MustCompile(`^\s*(\d+)\s+(\S+)\s+\((\d+\.\d+\.\d+\.\d+)\)\s+([\d.]+)\s+ms`)
+const reAddr = `(\d+\.\d+\.\d+\.\d+|[0-9A-Fa-f]*:[0-9A-Fa-f:.]+)`
+
+var reUnixHopNumeric = regexp.MustCompile(`^\s*(\d+)\s+` + reAddr + `\s+([\d.]+)\s+ms`)
+var reUnixHopNamed = regexp.MustCompile(`^\s*(\d+)\s+(\S+)\s+\(` + reAddr + `\)\s+([\d.]+)\s+ms`)
 var reUnixTimeout = regexp.MustCompile(`^\s*(\d+)\s+\*`)
 
 func parseUnixLine(line, destIP string) (Hop, bool) {
@@ -348,7 +528,7 @@ func parseUnixLine(line, destIP string) (Hop, bool) {
 	// Numeric-only (with -n)
 	if m := reUnixHopNumeric.FindStringSubmatch(line); m != nil {
 		ttl, _ := strconv.Atoi(m[1])
-		ip := m[2]
+		ip := canonicalIP(m[2])
 		rtt, _ := strconv.ParseFloat(m[3], 64)
 		return Hop{
 			TTL:     ttl,
@@ -363,7 +543,7 @@ func parseUnixLine(line, destIP string) (Hop, bool) {
 	if m := reUnixHopNamed.FindStringSubmatch(line); m != nil {
 		ttl, _ := strconv.Atoi(m[1])
 		hostname := m[2]
-		ip := m[3]
+		ip := canonicalIP(m[3])
 		rtt, _ := strconv.ParseFloat(m[4], 64)
 		return Hop{
 			TTL:      ttl,
@@ -378,15 +558,20 @@ func parseUnixLine(line, destIP string) (Hop, bool) {
 	return Hop{}, false
 }
 
-var reWinHop = regexp.MustCompile(`^\s*(\d+)\s+(?:<?\d+\s+ms\s+){1,3}\s*(\S+)`)
+// tracert prints "host [address]" when it resolved a name, for IPv4 and IPv6
+// alike, and the bare address otherwise.  Lost probes print as "*" in any of
+// the three time columns.
+var reWinHop = regexp.MustCompile(`^\s*(\d+)\s+(?:(?:<?\d+\s+ms|\*)\s+){1,3}\s*(\S+(?: \[[^\]]+\])?)`)
 var reWinRTT = regexp.MustCompile(`(\d+)\s+ms`)
 var reWinTimeout = regexp.MustCompile(`^\s*(\d+)\s+\*`)
 
 func parseWindowsLine(line, destIP string) (Hop, bool) {
-	if reWinTimeout.MatchString(line) && strings.Contains(line, "*") {
+	// tracert always sends three probes per hop; lost ones print as "*".
+	lost := strings.Count(line, "*")
+	if reWinTimeout.MatchString(line) && !reWinRTT.MatchString(line) {
 		m := reWinTimeout.FindStringSubmatch(line)
 		ttl, _ := strconv.Atoi(m[1])
-		return Hop{TTL: ttl, Success: false, IsTimeout: true}, true
+		return Hop{TTL: ttl, Success: false, IsTimeout: true, Sent: lost, Loss: 100}, true
 	}
 	m := reWinHop.FindStringSubmatch(line)
 	if m == nil {
@@ -394,22 +579,31 @@ func parseWindowsLine(line, destIP string) (Hop, bool) {
 	}
 	ttl, _ := strconv.Atoi(m[1])
 	host := strings.TrimSpace(m[2])
-	rtts := reWinRTT.FindAllStringSubmatch(line, -1)
-	var rtt float64
-	if len(rtts) > 0 {
-		rtt, _ = strconv.ParseFloat(rtts[0][1], 64)
+	var samples []float64
+	for _, r := range reWinRTT.FindAllStringSubmatch(line, -1) {
+		rtt, _ := strconv.ParseFloat(r[1], 64)
+		samples = append(samples, rtt)
 	}
 	ip, hostname := host, ""
 	if idx := strings.Index(host, " ["); idx != -1 {
 		hostname = host[:idx]
 		ip = strings.Trim(host[idx+2:], "]")
 	}
-	return Hop{
+	ip = canonicalIP(ip)
+	hop := Hop{
 		TTL:      ttl,
 		IP:       ip,
 		Hostname: hostname,
-		RTT:      rtt,
-		Success:  true,
 		IsFinal:  destIP != "" && (ip == destIP || host == destIP),
-	}, true
+	}
+	var stats rttStats
+	for _, rtt := range samples {
+		stats.add(Hop{Success: true, RTT: rtt})
+	}
+	for i := 0; i < lost; i++ {
+		stats.add(Hop{})
+	}
+	stats.apply(&hop)
+	hop.RTT = stats.first
+	return hop, true
 }
@@ -0,0 +1,72 @@
+package traceroute
+
+// Enricher annotates hops with data the probes themselves do not carry, such
+// as the autonomous system an address belongs to.  Run passes every hop
+// through Options.Enrichers before sending it on.  Enrich may be called from
+// several traces at once and should not block for long; a hop it knows
+// nothing about is left unchanged.
+type Enricher interface {
+	Enrich(hop *Hop)
+}
+
+// enrichStage returns a channel to send hops to in place of out.  Each hop is
+// passed through enrichers, marked as an AS boundary or not, and forwarded to
+// out.  wait must be called once no more hops will be sent; it returns after
+// the last one has been forwarded.
+//
+// Hops can arrive out of TTL order, so a boundary is judged against the hops
+// seen so far.  Continuous sessions re-send every hop and so settle on the
+// right answer; MarkASBoundaries corrects a finished single pass.
+func enrichStage(enrichers []Enricher, out chan<- Hop) (in chan<- Hop, wait func()) {
+	ch := make(chan Hop)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		asnByTTL := map[int]int{}
+		for hop := range ch {
+			for _, e := range enrichers {
+				e.Enrich(&hop)
+			}
+			if hop.ASN != 0 {
+				asnByTTL[hop.TTL] = hop.ASN
+				prev := 0
+				for ttl := hop.TTL - 1; ttl > 0 && prev == 0; ttl-- {
+					prev = asnByTTL[ttl]
+				}
+				hop.ASBoundary = prev != 0 && prev != hop.ASN
+			}
+			out <- hop
+		}
+	}()
+	return ch, func() {
+		close(ch)
+		<-done
+	}
+}
+
+// EnrichHops passes each of hops, which must be in TTL order, through
+// enrichers and then marks AS boundaries.  It is for hops that did not come
+// from Run, such as those of an imported report.
+func EnrichHops(hops []Hop, enrichers []Enricher) {
+	for i := range hops {
+		for _, e := range enrichers {
+			e.Enrich(&hops[i])
+		}
+	}
+	MarkASBoundaries(hops)
+}
+
+// MarkASBoundaries sets ASBoundary on every hop, in TTL order, whose AS
+// differs from that of the nearest earlier hop with a known AS.  Hops of
+// unknown AS, such as private addresses and timeouts, are never boundaries
+// and do not separate the hops around them.
+func MarkASBoundaries(hops []Hop) {
+	prev := 0
+	for i := range hops {
+		h := &hops[i]
+		h.ASBoundary = h.ASN != 0 && prev != 0 && h.ASN != prev
+		if h.ASN != 0 {
+			prev = h.ASN
+		}
+	}
+}
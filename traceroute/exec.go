@@ -0,0 +1,52 @@
+package traceroute
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// execProber probes one TTL by running the system traceroute binary with
+// -f N -m N, so each process probes exactly that one hop and exits.
+//
+// On macOS and Linux the binary already carries the setuid-root bit set by
+// the OS vendor, so no additional privileges are required from the calling
+// process.
+type execProber struct {
+	binary      string
+	familyArgs  []string // e.g. -6 for Linux traceroute
+	destIP      string
+	timeoutSecs int
+}
+
+// Probe runs one traceroute process for ttl and parses its single hop line.
+func (p *execProber) Probe(ctx context.Context, ttl int) Hop {
+	args := append([]string{}, p.familyArgs...)
+	args = append(args,
+		"-f", strconv.Itoa(ttl),
+		"-m", strconv.Itoa(ttl),
+		"-q", "1",
+		"-w", strconv.Itoa(p.timeoutSecs),
+		"-n",
+		p.destIP,
+	)
+	cmd := exec.CommandContext(ctx, p.binary, args...)
+	out, _ := cmd.Output()
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "traceroute") {
+			continue
+		}
+		if h, ok := parseUnixLine(line, p.destIP); ok {
+			return h
+		}
+	}
+	return Hop{}
+}
+
+// Close is a no-op: every probe runs in its own process.
+func (p *execProber) Close() error {
+	return nil
+}
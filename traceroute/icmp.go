@@ -0,0 +1,439 @@
+package traceroute
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// IANA protocol numbers, as expected by icmp.ParseMessage and found in the
+// protocol (IPv4) or next header (IPv6) field of quoted packets.
+const (
+	protocolICMP   = 1
+	protocolTCP    = 6
+	protocolUDP    = 17
+	protocolICMPv6 = 58
+)
+
+// icmpFamily holds what differs between ICMPv4 and ICMPv6 for the probers.
+type icmpFamily struct {
+	v6              bool
+	network         string // icmp.ListenPacket network for a raw socket
+	dgramNetwork    string // ... and for an unprivileged datagram socket
+	address         string // wildcard listen address
+	protocol        int    // ICMP protocol number, for icmp.ParseMessage
+	echoRequest     icmp.Type
+	echoReply       icmp.Type
+	timeExceeded    icmp.Type
+	dstUnreach      icmp.Type
+	portUnreachable int // Destination Unreachable code for "port unreachable"
+}
+
+var (
+	familyV4 = &icmpFamily{
+		network:         "ip4:icmp",
+		dgramNetwork:    "udp4",
+		address:         "0.0.0.0",
+		protocol:        protocolICMP,
+		echoRequest:     ipv4.ICMPTypeEcho,
+		echoReply:       ipv4.ICMPTypeEchoReply,
+		timeExceeded:    ipv4.ICMPTypeTimeExceeded,
+		dstUnreach:      ipv4.ICMPTypeDestinationUnreachable,
+		portUnreachable: 3,
+	}
+	familyV6 = &icmpFamily{
+		v6:              true,
+		network:         "ip6:ipv6-icmp",
+		dgramNetwork:    "udp6",
+		address:         "::",
+		protocol:        protocolICMPv6,
+		echoRequest:     ipv6.ICMPTypeEchoRequest,
+		echoReply:       ipv6.ICMPTypeEchoReply,
+		timeExceeded:    ipv6.ICMPTypeTimeExceeded,
+		dstUnreach:      ipv6.ICMPTypeDestinationUnreachable,
+		portUnreachable: 4,
+	}
+)
+
+// familyOf returns the ICMP family to probe ip with.
+func familyOf(ip net.IP) *icmpFamily {
+	if ip.To4() != nil {
+		return familyV4
+	}
+	return familyV6
+}
+
+// typeByte returns the wire value of an ICMP type, for comparing against
+// quoted packets.
+func typeByte(t icmp.Type) byte {
+	switch t := t.(type) {
+	case ipv4.ICMPType:
+		return byte(t)
+	case ipv6.ICMPType:
+		return byte(t)
+	}
+	return 0
+}
+
+// ── ICMP listener ─────────────────────────────────────────────────────────────
+
+// icmpListener reads ICMP messages from a socket and hands each one to the
+// probe waiting for it.  Probes are identified by a 16-bit key (an Echo
+// sequence number, a UDP port, ...) that the classify func extracts from the
+// message.
+type icmpListener struct {
+	conn   *icmp.PacketConn
+	raw    bool // raw socket; false means an unprivileged datagram socket
+	family *icmpFamily
+
+	// classify maps a received message to the key of the probe it answers.
+	// final reports that the destination itself answered.
+	classify func(msg *icmp.Message) (key uint16, final bool, ok bool)
+
+	mu      sync.Mutex
+	pending map[uint16]chan icmpReply
+}
+
+// icmpReply is what the read loop hands back to a waiting probe.
+type icmpReply struct {
+	peer    net.IP
+	final   bool
+	receive time.Time
+	mpls    []MPLSLabel
+}
+
+// listenICMP opens an ICMP socket of the given family.  A raw socket is tried
+// first; when allowDgram is set, macOS' unprivileged datagram socket is
+// accepted as a fallback.  Linux also offers datagram ICMP sockets, but they
+// only deliver Echo Replies (errors such as Time Exceeded go to the socket
+// error queue), which is not enough to trace with.
+func listenICMP(f *icmpFamily, allowDgram bool) (*icmp.PacketConn, bool, error) {
+	conn, err := icmp.ListenPacket(f.network, f.address)
+	if err == nil {
+		return conn, true, nil
+	}
+	if allowDgram && runtime.GOOS == "darwin" {
+		if conn, dgramErr := icmp.ListenPacket(f.dgramNetwork, f.address); dgramErr == nil {
+			return conn, false, nil
+		}
+	}
+	return nil, false, err
+}
+
+// setTTL sets the TTL (IPv4) or unicast hop limit (IPv6) for the next
+// packets written to conn.
+func (l *icmpListener) setTTL(ttl int) error {
+	if l.family.v6 {
+		return l.conn.IPv6PacketConn().SetHopLimit(ttl)
+	}
+	return l.conn.IPv4PacketConn().SetTTL(ttl)
+}
+
+// start launches the read loop.  It stops when conn is closed.
+func (l *icmpListener) start() {
+	l.pending = map[uint16]chan icmpReply{}
+	go l.readLoop()
+}
+
+// register reserves key for a probe about to be sent and returns the channel
+// its reply will arrive on.  The caller must call unregister when done.
+func (l *icmpListener) register(key uint16) chan icmpReply {
+	ch := make(chan icmpReply, 1)
+	l.mu.Lock()
+	l.pending[key] = ch
+	l.mu.Unlock()
+	return ch
+}
+
+func (l *icmpListener) unregister(key uint16) {
+	l.mu.Lock()
+	delete(l.pending, key)
+	l.mu.Unlock()
+}
+
+// readLoop dispatches every ICMP message received on the socket to the probe
+// it answers, until the socket is closed.
+func (l *icmpListener) readLoop() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+
+		msg, err := icmp.ParseMessage(l.family.protocol, buf[:n])
+		if err != nil {
+			continue
+		}
+		key, final, ok := l.classify(msg)
+		if !ok {
+			continue
+		}
+
+		l.mu.Lock()
+		ch := l.pending[key]
+		l.mu.Unlock()
+		if ch == nil {
+			continue
+		}
+		select {
+		case ch <- icmpReply{peer: addrIP(peer), final: final, receive: now, mpls: mplsLabels(msg)}:
+		default:
+		}
+	}
+}
+
+// await waits for the reply to a probe sent at sent with the given TTL and
+// turns it into a Hop.  It returns a zero Hop on timeout or cancellation.
+func await(ctx context.Context, ch <-chan icmpReply, ttl int, sent time.Time, timeout time.Duration) Hop {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-ch:
+		return Hop{
+			TTL:     ttl,
+			IP:      r.peer.String(),
+			RTT:     float64(r.receive.Sub(sent).Microseconds()) / 1000,
+			Success: true,
+			IsFinal: r.final,
+			MPLS:    r.mpls,
+		}
+	case <-timer.C:
+		return Hop{}
+	case <-ctx.Done():
+		return Hop{}
+	}
+}
+
+// quoted returns the transport header of the original packet quoted inside
+// an ICMP Time Exceeded or Destination Unreachable message (an IPv4 or IPv6
+// header followed by at least 8 bytes of payload), provided its protocol is
+// proto.  It also returns the quoted destination address.  IPv6 extension
+// headers are not followed; probes are sent without any.
+func quoted(msg *icmp.Message, proto byte) ([]byte, net.IP, bool) {
+	var data []byte
+	switch body := msg.Body.(type) {
+	case *icmp.TimeExceeded:
+		data = body.Data
+	case *icmp.DstUnreach:
+		data = body.Data
+	default:
+		return nil, nil, false
+	}
+	if len(data) < ipv4.HeaderLen {
+		return nil, nil, false
+	}
+	if data[0]>>4 == 6 {
+		if len(data) < ipv6.HeaderLen+8 || data[6] != proto {
+			return nil, nil, false
+		}
+		return data[ipv6.HeaderLen:], net.IP(data[24:40]), true
+	}
+	ihl := int(data[0]&0x0f) * 4
+	if data[9] != proto || len(data) < ihl+8 {
+		return nil, nil, false
+	}
+	return data[ihl:], net.IP(data[16:20]), true
+}
+
+// mplsLabels returns the MPLS label stack a router appended to a Time
+// Exceeded or Destination Unreachable message as an RFC 4884 extension
+// (RFC 4950), or nil.  icmp.ParseMessage already recognises the extension
+// structure, including that of older routers which pad the quoted packet to
+// 128 bytes without saying so.
+func mplsLabels(msg *icmp.Message) []MPLSLabel {
+	var exts []icmp.Extension
+	switch body := msg.Body.(type) {
+	case *icmp.TimeExceeded:
+		exts = body.Extensions
+	case *icmp.DstUnreach:
+		exts = body.Extensions
+	}
+	var labels []MPLSLabel
+	for _, ext := range exts {
+		if stack, ok := ext.(*icmp.MPLSLabelStack); ok {
+			for _, l := range stack.Labels {
+				labels = append(labels, MPLSLabel{Label: l.Label, TC: l.TC, S: l.S, TTL: l.TTL})
+			}
+		}
+	}
+	return labels
+}
+
+// addrIP returns the IP of a peer address from either socket flavour.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// probeTimeout converts Options.TimeoutMs for the native probers.
+func probeTimeout(opts *Options) time.Duration {
+	if opts.TimeoutMs <= 0 {
+		return time.Second
+	}
+	return time.Duration(opts.TimeoutMs) * time.Millisecond
+}
+
+// resolveDest resolves dest for the native probers, honouring
+// opts.IPVersion.
+func resolveDest(dest string, opts *Options) (net.IP, error) {
+	addrs := resolveAddrs(dest, opts.IPVersion)
+	if len(addrs) == 0 {
+		switch opts.IPVersion {
+		case 4:
+			return nil, fmt.Errorf("cannot resolve %s to an IPv4 address", dest)
+		case 6:
+			return nil, fmt.Errorf("cannot resolve %s to an IPv6 address", dest)
+		}
+		return nil, fmt.Errorf("cannot resolve %s", dest)
+	}
+	return addrs[0], nil
+}
+
+// ── ICMP Echo prober ──────────────────────────────────────────────────────────
+
+// icmpProber sends ICMP (or ICMPv6) Echo Requests with a chosen TTL over a
+// single shared socket and matches the Time Exceeded / Echo Reply messages that come back
+// to the probe that caused them, using the Echo sequence number.
+type icmpProber struct {
+	icmpListener
+	dst     net.Addr
+	id      int
+	timeout time.Duration
+
+	// writeMu serialises SetTTL+WriteTo: the TTL is a socket option, so two
+	// probes must not interleave between setting it and sending.
+	writeMu sync.Mutex
+
+	seqMu sync.Mutex
+	seq   uint16
+
+	flows *flowPicker // nil unless Options.Paris
+}
+
+// echoProbers counts the ICMP probers created so far.  Raw sockets see every
+// ICMP message, so probers running side by side in one process need
+// distinct Echo IDs to tell their replies apart.
+var echoProbers atomic.Uint32
+
+// newICMPProber opens an ICMP socket for probing dest.
+func newICMPProber(dest string, opts *Options) (*icmpProber, error) {
+	destIP, err := resolveDest(dest, opts)
+	if err != nil {
+		return nil, err
+	}
+	family := familyOf(destIP)
+	conn, raw, err := listenICMP(family, true)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &icmpProber{
+		id:      (os.Getpid() + int(echoProbers.Add(1)-1)) & 0xffff,
+		timeout: probeTimeout(opts),
+	}
+	p.conn, p.raw, p.family = conn, raw, family
+	if opts.Paris {
+		p.flows = newFlowPicker(opts)
+	}
+	if raw {
+		p.dst = &net.IPAddr{IP: destIP}
+	} else {
+		p.dst = &net.UDPAddr{IP: destIP}
+	}
+	p.classify = p.match
+	p.start()
+	return p, nil
+}
+
+// Close releases the socket, which also stops the read loop.
+func (p *icmpProber) Close() error {
+	return p.conn.Close()
+}
+
+// Probe sends one Echo Request with the given TTL and waits for whatever
+// answers it.  It returns a zero Hop on timeout.
+func (p *icmpProber) Probe(ctx context.Context, ttl int) Hop {
+	p.seqMu.Lock()
+	p.seq++
+	seq := p.seq
+	p.seqMu.Unlock()
+
+	ch := p.register(seq)
+	defer p.unregister(seq)
+
+	data := []byte("traceroute")
+	if p.flows != nil {
+		flow := p.flows.id(p.flows.next(ttl))
+		data = parisEchoData(typeByte(p.family.echoRequest), p.id, int(seq), flow)
+	}
+	msg := icmp.Message{
+		Type: p.family.echoRequest,
+		Body: &icmp.Echo{ID: p.id, Seq: int(seq), Data: data},
+	}
+	// ICMPv6 checksums cover a pseudo-header; with a nil one Marshal leaves
+	// the checksum to the kernel, which fills it in for ICMPv6 sockets.
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return Hop{}
+	}
+
+	p.writeMu.Lock()
+	if err := p.setTTL(ttl); err != nil {
+		p.writeMu.Unlock()
+		return Hop{}
+	}
+	sent := time.Now()
+	_, err = p.conn.WriteTo(b, p.dst)
+	p.writeMu.Unlock()
+	if err != nil {
+		return Hop{}
+	}
+
+	return await(ctx, ch, ttl, sent, p.timeout)
+}
+
+// match keys replies by Echo sequence number.  Datagram sockets have their
+// Echo ID rewritten by the kernel, so the ID can only be checked on raw
+// sockets.
+func (p *icmpProber) match(msg *icmp.Message) (uint16, bool, bool) {
+	switch msg.Type {
+	case p.family.echoReply:
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || (p.raw && echo.ID != p.id) {
+			return 0, false, false
+		}
+		return uint16(echo.Seq), true, true
+	case p.family.timeExceeded, p.family.dstUnreach:
+		proto := byte(protocolICMP)
+		if p.family.v6 {
+			proto = protocolICMPv6
+		}
+		inner, _, ok := quoted(msg, proto)
+		if !ok || inner[0] != typeByte(p.family.echoRequest) {
+			return 0, false, false
+		}
+		if p.raw && int(binary.BigEndian.Uint16(inner[4:6])) != p.id {
+			return 0, false, false
+		}
+		return binary.BigEndian.Uint16(inner[6:8]), false, true
+	}
+	return 0, false, false
+}
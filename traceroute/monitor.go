@@ -0,0 +1,108 @@
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultIntervalMs is the pause between rounds in continuous mode when
+// Options.IntervalMs is not set.
+const DefaultIntervalMs = 1000
+
+// errNoContinuous is returned when continuous mode is asked of a backend that
+// cannot probe one TTL at a time (the Windows tracert fallback).
+var errNoContinuous = errors.New("continuous mode needs a per-TTL prober; use the icmp method")
+
+// runMonitor is the continuous (MTR-style) counterpart of runProbes: it
+// probes every TTL once per round, keeps cumulative statistics per TTL and
+// sends the updated Hop after every probe, until ctx is cancelled.  The RTT
+// of each emitted Hop is the most recent one; MinRTT/AvgRTT/MaxRTT are the
+// best/average/worst over the whole session.
+//
+// The first round probes up to opts.MaxHops; once the destination has
+// answered, later rounds stop at its TTL.
+func runMonitor(ctx context.Context, dest string, opts *Options, hops chan<- Hop, prober Prober, names *hostnames) error {
+	destIPs := resolveIPs(dest, opts.IPVersion)
+
+	interval := time.Duration(opts.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = DefaultIntervalMs * time.Millisecond
+	}
+
+	type hopState struct {
+		hop   Hop // address and hostname of the latest responder
+		stats rttStats
+	}
+
+	var mu sync.Mutex
+	states := map[int]*hopState{}
+	finalTTL := opts.MaxHops + 1 // "not yet known"
+
+	for ctx.Err() == nil {
+		roundStart := time.Now()
+
+		mu.Lock()
+		limit := min(finalTTL, opts.MaxHops)
+		mu.Unlock()
+
+		var wg sync.WaitGroup
+		for ttl := 1; ttl <= limit; ttl++ {
+			wg.Add(1)
+			go func(ttl int) {
+				defer wg.Done()
+
+				result := prober.Probe(ctx, ttl)
+				if ctx.Err() != nil {
+					return // cancelled probes are not losses
+				}
+				if result.Success && result.Hostname == "" {
+					result.Hostname = names.name(ttl, result.IP)
+				}
+
+				mu.Lock()
+				reached := result.Success && (result.IsFinal || destIPs[result.IP])
+				if reached && ttl < finalTTL {
+					finalTTL = ttl
+					for t := range states {
+						if t > ttl {
+							delete(states, t)
+						}
+					}
+				}
+				if ttl > finalTTL {
+					mu.Unlock()
+					return
+				}
+				st := states[ttl]
+				if st == nil {
+					st = &hopState{}
+					states[ttl] = st
+				}
+				if result.Success {
+					st.hop = result
+				}
+				st.stats.add(result)
+
+				hop := st.hop
+				hop.TTL = ttl
+				hop.IsFinal = ttl == finalTTL
+				st.stats.apply(&hop)
+				mu.Unlock()
+
+				select {
+				case hops <- hop:
+				case <-ctx.Done():
+				}
+			}(ttl)
+		}
+		wg.Wait()
+
+		select {
+		case <-time.After(time.Until(roundStart.Add(interval))):
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
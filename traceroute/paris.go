@@ -0,0 +1,113 @@
+package traceroute
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// Paris-traceroute style probing.
+//
+// Per-flow load balancers pick the next hop from a hash over the flow
+// identifier: addresses and ports for UDP, and for ICMP the first words of
+// the ICMP header, checksum included.  Classic traceroute changes the UDP
+// destination port, or the Echo sequence number and with it the checksum, on
+// every probe, so consecutive TTLs can be hashed onto different branches and
+// the path seems to jump between routers.
+//
+// In Paris mode every probe of a flow carries the same flow identifier.
+// Probes are still told apart, by a field the balancers don't hash:
+//
+//   - ICMP Echo: the sequence number still varies, but two payload bytes
+//     are chosen so that the ICMP checksum stays the same for every probe.
+//   - UDP: ports, length and checksum stay fixed.  The probe is identified
+//     by the first payload word, followed by its ones' complement so that
+//     the checksum does not change.  Matching a reply needs a router that
+//     quotes more than the 8 bytes of UDP header RFC 792 asks for; RFC
+//     1812 and RFC 4443 routers quote far more.
+//
+// Options.FlowID picks the flow.  With Options.Flows > 1 the k-th probe of a
+// TTL uses flow FlowID + k%Flows, so sending at least Flows probes per TTL
+// enumerates that many alternate paths, each reported as a Responder.
+
+// parisPayload is the Echo payload sent after the two compensation bytes.
+var parisPayload = []byte("traceroute")
+
+// parisUDPData returns the UDP payload of the Paris probe with the given
+// identifier.  Every payload sums to the same value, so the UDP checksum is
+// constant for a flow.
+func parisUDPData(id uint16) []byte {
+	return append([]byte{byte(id >> 8), byte(id), ^byte(id >> 8), ^byte(id)}, parisPayload...)
+}
+
+// flowPicker hands out flow indexes: each TTL cycles through the configured
+// flows independently, so the k-th probe of every TTL uses the same flow.
+type flowPicker struct {
+	first, count int
+
+	mu   sync.Mutex
+	sent map[int]int // probes sent so far, per TTL
+}
+
+func newFlowPicker(opts *Options) *flowPicker {
+	count := opts.Flows
+	if count < 1 {
+		count = 1
+	}
+	first := opts.FlowID
+	if first < 0 {
+		first = 0
+	}
+	return &flowPicker{first: first, count: count, sent: map[int]int{}}
+}
+
+// next returns the flow for the next probe at ttl, counted from zero.
+func (f *flowPicker) next(ttl int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := f.sent[ttl]
+	f.sent[ttl]++
+	return n % f.count
+}
+
+// id returns the Options.FlowID-based identifier of flow.
+func (f *flowPicker) id(flow int) int {
+	return f.first + flow
+}
+
+// onesSum adds b as big-endian 16-bit words to sum, without folding.
+func onesSum(sum uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+// fold reduces a ones-complement sum to 16 bits.
+func fold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return uint16(sum)
+}
+
+// compensate returns the 16-bit word that, added to a ones-complement sum
+// currently equal to have, makes it equal want.
+func compensate(have, want uint16) uint16 {
+	return fold(uint32(want) + uint32(^have))
+}
+
+// parisEchoData returns an Echo payload for which the ICMP message sums to
+// the same value whatever the sequence number, so its checksum is constant
+// for a given flow.  typ is the Echo Request type on the wire.
+func parisEchoData(typ byte, id, seq int, flow int) []byte {
+	want := uint16(0x4000 + flow)
+	sum := onesSum(0, []byte{typ, 0})
+	sum = onesSum(sum, []byte{byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)})
+	sum = onesSum(sum, parisPayload)
+	c := compensate(fold(sum), want)
+	return append([]byte{byte(c >> 8), byte(c)}, parisPayload...)
+}
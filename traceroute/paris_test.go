@@ -0,0 +1,30 @@
+package traceroute
+
+import "testing"
+
+func TestParisUDPDataConstantSum(t *testing.T) {
+	want := parisUDPData(0)
+	for _, id := range []uint16{1, 2, 0x00ff, 0x1234, 0xfffe, 0xffff} {
+		got := parisUDPData(id)
+		if len(got) != len(want) {
+			t.Errorf("id %#x: payload length %d, want %d", id, len(got), len(want))
+		}
+		if fold(onesSum(0, got)) != fold(onesSum(0, want)) {
+			t.Errorf("id %#x: payload sum %#x, want %#x", id, fold(onesSum(0, got)), fold(onesSum(0, want)))
+		}
+	}
+}
+
+func TestParisEchoDataConstantSum(t *testing.T) {
+	const typ, id, flow = 8, 0x4242, 3
+	sum := func(seq int) uint16 {
+		s := onesSum(0, []byte{typ, 0, id >> 8, id & 0xff, byte(seq >> 8), byte(seq)})
+		return fold(onesSum(s, parisEchoData(typ, id, seq, flow)))
+	}
+	want := sum(0)
+	for _, seq := range []int{1, 7, 255, 256, 4097, 65535} {
+		if got := sum(seq); got != want {
+			t.Errorf("seq %d: message sum %#x, want %#x", seq, got, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package traceroute
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Report is a trace recovered from the text output of another tool, such as
+// traceroute output pasted into a ticket.
+type Report struct {
+	Destination string // as named in the output, else the last hop
+	Source      string // host the trace ran on, when the output says (mtr)
+	Format      string // "traceroute", "tracert" or "mtr"
+	Hops        []Hop  // in TTL order
+}
+
+// ErrNoHops is returned by ParseReport when the text contains no hop lines.
+var ErrNoHops = errors.New("no traceroute hops found")
+
+var (
+	reUnixHeader = regexp.MustCompile(`^traceroute6?\s+to\s+(\S+)(?:\s+\(` + reAddr + `\))?`)
+	reWinHeader  = regexp.MustCompile(`^Tracing route to (\S+)(?: \[` + reAddr + `\])?`)
+	reMtrHost    = regexp.MustCompile(`^HOST:\s+(\S+)`)
+	reLeadingTTL = regexp.MustCompile(`^\s*\d+\s+`)
+
+	// tracert prints times before the address, traceroute after it.
+	reWinTimesFirst = regexp.MustCompile(`^\s*\d+\s+(?:\*\s+)*<?\d+\s+ms\s`)
+
+	// Every probe on a traceroute line: "host (addr) 1.2 ms", "addr 1.2 ms",
+	// a further "1.2 ms" for the same address, or "*".
+	reUnixProbe = regexp.MustCompile(`(?:(\S+)\s+\(` + reAddr + `\)\s+|` + reAddr + `\s+)?([\d.]+)\s+ms|\*`)
+
+	// mtr --report rows, optionally with -b ("host (addr)") or -z (AS column):
+	//
+	//	"  1.|-- 192.168.1.1   0.0%    10    0.5   0.6   0.4   0.9   0.1"
+	reMtrHop = regexp.MustCompile(`^\s*(\d+)\.\s*(?:AS(\S+)\s+)?(?:\|-+\s+)?(.+?)\s+([\d.]+)%?\s+(\d+)` +
+		`\s+([\d.]+)\s+([\d.]+)\s+([\d.]+)\s+([\d.]+)\s+([\d.]+)\s*$`)
+	reMtrHostAddr = regexp.MustCompile(`^(\S+)\s+\(` + reAddr + `\)$`)
+)
+
+// ParseReport reads the output of traceroute/traceroute6, Windows tracert or
+// mtr --report and returns the trace it describes.  The format is detected
+// from the header when present and otherwise line by line.  When the output
+// does not name the destination, the last hop is taken to be it.
+func ParseReport(r io.Reader) (*Report, error) {
+	rep := &Report{}
+	destIP := ""
+	hops := map[int]Hop{}
+	probes := map[int][]Hop{} // traceroute probes per TTL, for continuation lines
+	lastTTL := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if m := reUnixHeader.FindStringSubmatch(trimmed); m != nil {
+			rep.Format, rep.Destination, destIP = "traceroute", m[1], headerIP(m[1], m[2])
+			continue
+		}
+		if m := reWinHeader.FindStringSubmatch(trimmed); m != nil {
+			rep.Format, rep.Destination, destIP = "tracert", m[1], headerIP(m[1], m[2])
+			continue
+		}
+		if m := reMtrHost.FindStringSubmatch(trimmed); m != nil {
+			rep.Format, rep.Source = "mtr", m[1]
+			continue
+		}
+		if strings.HasPrefix(trimmed, "Start:") {
+			rep.Format = "mtr"
+			continue
+		}
+
+		if hop, ok := parseMtrLine(line); ok {
+			if rep.Format == "" {
+				rep.Format = "mtr"
+			}
+			if _, dup := hops[hop.TTL]; !dup {
+				hops[hop.TTL] = hop
+			}
+			lastTTL = hop.TTL
+			continue
+		}
+
+		if rep.Format == "" && reWinTimesFirst.MatchString(line) {
+			rep.Format = "tracert"
+		}
+		if rep.Format == "tracert" {
+			if hop, ok := parseWindowsLine(line, destIP); ok {
+				if _, dup := hops[hop.TTL]; !dup {
+					hops[hop.TTL] = hop
+				}
+				lastTTL = hop.TTL
+			}
+			continue
+		}
+
+		if hop, ok := parseUnixLine(line, destIP); ok {
+			if _, dup := hops[hop.TTL]; dup {
+				continue
+			}
+			results := unixProbes(reLeadingTTL.ReplaceAllString(line, ""), destIP)
+			if len(results) > 0 {
+				hop = summarize(hop.TTL, results)
+			}
+			hops[hop.TTL] = hop
+			probes[hop.TTL] = results
+			lastTTL = hop.TTL
+			continue
+		}
+
+		// traceroute prints further responders for a TTL on indented lines
+		// of their own on some systems.
+		if lastTTL > 0 && probes[lastTTL] != nil && !reLeadingTTL.MatchString(line) {
+			if more := unixProbes(line, destIP); len(more) > 0 {
+				probes[lastTTL] = append(probes[lastTTL], more...)
+				hops[lastTTL] = summarize(lastTTL, probes[lastTTL])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(hops) == 0 {
+		return nil, ErrNoHops
+	}
+
+	for _, hop := range hops {
+		rep.Hops = append(rep.Hops, hop)
+	}
+	sort.Slice(rep.Hops, func(i, j int) bool { return rep.Hops[i].TTL < rep.Hops[j].TTL })
+	MarkASBoundaries(rep.Hops)
+	final := false
+	for _, h := range rep.Hops {
+		final = final || h.IsFinal
+	}
+	last := &rep.Hops[len(rep.Hops)-1]
+	if !final && last.Success && (destIP == "" || rep.Format == "mtr") {
+		// mtr stops at the destination, and pasted output usually does.
+		last.IsFinal = true
+	}
+	if rep.Destination == "" {
+		rep.Destination = last.Hostname
+		if rep.Destination == "" {
+			rep.Destination = last.IP
+		}
+	}
+	if rep.Format == "" {
+		rep.Format = "traceroute"
+	}
+	return rep, nil
+}
+
+// headerIP returns the destination address named in a header line, where
+// the tool printed either "name (addr)" or just the address.
+func headerIP(name, addr string) string {
+	if addr == "" && net.ParseIP(name) != nil {
+		addr = name
+	}
+	if addr == "" {
+		return ""
+	}
+	return canonicalIP(addr)
+}
+
+// unixProbes returns one result per probe printed on a traceroute line, with
+// the TTL already stripped.  Times are credited to the address printed
+// before them; unanswered probes are zero Hops.
+func unixProbes(line, destIP string) []Hop {
+	var results []Hop
+	var ip, hostname string
+	for _, m := range reUnixProbe.FindAllStringSubmatch(line, -1) {
+		switch {
+		case m[0] == "*":
+			results = append(results, Hop{})
+			continue
+		case m[2] != "":
+			ip, hostname = canonicalIP(m[2]), m[1]
+		case m[3] != "":
+			ip, hostname = canonicalIP(m[3]), ""
+		}
+		if ip == "" {
+			continue
+		}
+		if hostname == ip {
+			hostname = ""
+		}
+		rtt, _ := strconv.ParseFloat(m[4], 64)
+		results = append(results, Hop{
+			IP:       ip,
+			Hostname: hostname,
+			RTT:      rtt,
+			Success:  true,
+			IsFinal:  destIP != "" && ip == destIP,
+		})
+	}
+	return results
+}
+
+// parseMtrLine parses one row of mtr --report output.  mtr reports
+// statistics rather than probes, so they are copied over as they are, along
+// with the AS number when mtr was run with -z.
+func parseMtrLine(line string) (Hop, bool) {
+	m := reMtrHop.FindStringSubmatch(line)
+	if m == nil {
+		return Hop{}, false
+	}
+	ttl, _ := strconv.Atoi(m[1])
+	asn, _ := strconv.Atoi(m[2]) // "???" when mtr could not look it up
+	loss, _ := strconv.ParseFloat(m[4], 64)
+	sent, _ := strconv.Atoi(m[5])
+	hop := Hop{TTL: ttl, Sent: sent, Loss: loss, ASN: asn}
+
+	host := strings.TrimSpace(m[3])
+	if host == "???" {
+		hop.IsTimeout = true
+		return hop, true
+	}
+	if hm := reMtrHostAddr.FindStringSubmatch(host); hm != nil {
+		hop.Hostname, hop.IP = hm[1], canonicalIP(hm[2])
+	} else if net.ParseIP(host) != nil {
+		hop.IP = canonicalIP(host)
+	} else {
+		hop.Hostname = host
+	}
+
+	hop.Received = int(math.Round(float64(sent) * (100 - loss) / 100))
+	hop.Success = hop.Received > 0 || sent == 0
+	hop.IsTimeout = !hop.Success
+	hop.RTT, _ = strconv.ParseFloat(m[6], 64)
+	hop.AvgRTT, _ = strconv.ParseFloat(m[7], 64)
+	hop.MinRTT, _ = strconv.ParseFloat(m[8], 64)
+	hop.MaxRTT, _ = strconv.ParseFloat(m[9], 64)
+	hop.StdDevRTT, _ = strconv.ParseFloat(m[10], 64)
+	return hop, true
+}
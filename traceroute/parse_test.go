@@ -0,0 +1,155 @@
+package traceroute
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wantHop is the part of a parsed hop the tests check.
+type wantHop struct {
+	ttl      int
+	ip       string
+	hostname string
+	success  bool
+	final    bool
+	sent     int
+	received int
+	asn      int
+}
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		file        string
+		format      string
+		destination string
+		source      string
+		hops        []wantHop
+	}{
+		{
+			file: "linux.txt", format: "traceroute", destination: "example.com",
+			hops: []wantHop{
+				{1, "192.168.1.1", "_gateway", true, false, 3, 3, 0},
+				{2, "10.20.0.1", "", true, false, 3, 2, 0},
+				{3, "", "", false, false, 3, 0, 0},
+				{4, "203.0.113.9", "ae-1.r01.example.net", true, false, 3, 3, 0},
+				{5, "93.184.216.34", "", true, true, 3, 3, 0},
+			},
+		},
+		{
+			file: "traceroute6.txt", format: "traceroute", destination: "example.com",
+			hops: []wantHop{
+				{1, "2001:db8::1", "", true, false, 3, 3, 0},
+				{2, "2606:2800:220:1:248:1893:25c8:1946", "", true, true, 3, 3, 0},
+			},
+		},
+		{
+			file: "tracert.txt", format: "tracert", destination: "example.com",
+			hops: []wantHop{
+				{1, "192.168.1.1", "", true, false, 3, 3, 0},
+				{2, "10.20.0.1", "", true, false, 3, 3, 0},
+				{3, "", "", false, false, 3, 0, 0},
+				{4, "203.0.113.9", "ae-1.r01.example.net", true, false, 3, 3, 0},
+				{5, "93.184.216.34", "", true, true, 3, 3, 0},
+			},
+		},
+		{
+			file: "mtr.txt", format: "mtr", destination: "93.184.216.34", source: "probe-box",
+			hops: []wantHop{
+				{1, "192.168.1.1", "", true, false, 10, 10, 0},
+				{2, "", "", false, false, 10, 0, 0},
+				{3, "203.0.113.9", "", true, false, 10, 8, 0},
+				{4, "93.184.216.34", "", true, true, 10, 10, 0},
+			},
+		},
+		{
+			file: "mtr-bz.txt", format: "mtr", destination: "example.com", source: "probe-box",
+			hops: []wantHop{
+				{1, "192.168.1.1", "_gateway", true, false, 5, 5, 0},
+				{2, "203.0.113.9", "ae-1.r01.example.net", true, false, 5, 5, 64500},
+				{3, "93.184.216.34", "example.com", true, true, 5, 5, 15133},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			rep, err := ParseReport(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Format != tt.format || rep.Destination != tt.destination || rep.Source != tt.source {
+				t.Errorf("format, destination, source = %q, %q, %q; want %q, %q, %q",
+					rep.Format, rep.Destination, rep.Source, tt.format, tt.destination, tt.source)
+			}
+			if len(rep.Hops) != len(tt.hops) {
+				t.Fatalf("got %d hops, want %d", len(rep.Hops), len(tt.hops))
+			}
+			for i, w := range tt.hops {
+				h := rep.Hops[i]
+				got := wantHop{h.TTL, h.IP, h.Hostname, h.Success, h.IsFinal, h.Sent, h.Received, h.ASN}
+				if got != w {
+					t.Errorf("hop %d = %+v, want %+v", i+1, got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestParseReportResponders(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "linux.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rep, err := ParseReport(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TTL 4 answered from two routers of an ECMP pair; a time without an
+	// address before it belongs to the last address printed.
+	hop := rep.Hops[3]
+	if len(hop.Responders) != 2 {
+		t.Fatalf("TTL 4 has %d responders, want 2: %+v", len(hop.Responders), hop.Responders)
+	}
+	counts := map[string]int{}
+	for _, r := range hop.Responders {
+		counts[r.IP] = r.Count
+	}
+	if counts["203.0.113.9"] != 1 || counts["203.0.113.10"] != 2 {
+		t.Errorf("TTL 4 responders = %+v", hop.Responders)
+	}
+}
+
+func TestParseReportWithoutHeader(t *testing.T) {
+	text := " 1  192.168.1.1  0.5 ms  0.4 ms  0.4 ms\n 2  198.51.100.7  9.1 ms  9.0 ms  9.3 ms\n"
+	rep, err := ParseReport(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Format != "traceroute" || rep.Destination != "198.51.100.7" {
+		t.Errorf("format, destination = %q, %q", rep.Format, rep.Destination)
+	}
+	if last := rep.Hops[len(rep.Hops)-1]; !last.IsFinal {
+		t.Error("last hop of a headerless paste is not taken as the destination")
+	}
+}
+
+func TestParseReportNoHops(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"hello world\n",
+		"traceroute to example.com (93.184.216.34), 30 hops max\n",
+		"Tracing route to example.com [93.184.216.34]\nover a maximum of 30 hops:\n",
+	} {
+		if _, err := ParseReport(strings.NewReader(text)); !errors.Is(err, ErrNoHops) {
+			t.Errorf("ParseReport(%q) error = %v, want ErrNoHops", text, err)
+		}
+	}
+}
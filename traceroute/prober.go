@@ -0,0 +1,93 @@
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Prober sends probes towards a single destination, one TTL at a time.
+// Implementations must be safe for concurrent use: Run probes every TTL in
+// parallel.
+type Prober interface {
+	// Probe sends one probe with the given TTL and returns the hop that
+	// answered.  A zero Hop (TTL 0) means nothing answered in time.
+	Probe(ctx context.Context, ttl int) Hop
+	// Close releases any sockets or other resources held by the prober.
+	Close() error
+}
+
+// Method names a probing backend.
+type Method string
+
+const (
+	// MethodAuto uses the native ICMP prober when an ICMP socket can be
+	// opened and the system traceroute binary otherwise.
+	MethodAuto Method = ""
+	// MethodICMP sends ICMP Echo Requests from a native socket.
+	MethodICMP Method = "icmp"
+	// MethodUDP sends classic UDP datagrams to Options.Port and up.
+	MethodUDP Method = "udp"
+	// MethodTCP connects to Options.Port with TCP SYNs.
+	MethodTCP Method = "tcp"
+	// MethodExec shells out to the system traceroute (or tracert) binary.
+	MethodExec Method = "exec"
+)
+
+// errSequentialOnly is returned by NewProber when the exec backend is asked
+// for on a platform whose binary cannot probe a single TTL (Windows tracert).
+// Run handles it by tracing sequentially instead.
+var errSequentialOnly = errors.New("exec backend cannot probe a single TTL on this platform")
+
+// NewProber returns the backend selected by opts.Method for dest.
+func NewProber(dest string, opts *Options) (Prober, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	switch opts.Method {
+	case MethodAuto:
+		if p, err := newICMPProber(dest, opts); err == nil {
+			return p, nil
+		}
+		return newExecProber(dest, opts)
+	case MethodICMP:
+		return newICMPProber(dest, opts)
+	case MethodUDP:
+		return newUDPProber(dest, opts)
+	case MethodTCP:
+		return newTCPProber(dest, opts)
+	case MethodExec:
+		return newExecProber(dest, opts)
+	default:
+		return nil, fmt.Errorf("unknown probe method %q", opts.Method)
+	}
+}
+
+// newExecProber returns an execProber, or errSequentialOnly on Windows.
+func newExecProber(dest string, opts *Options) (Prober, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errSequentialOnly
+	}
+	// Hand the binary an address rather than the name, so that it traces
+	// the same family we resolved.
+	destIP := resolveIP(dest, opts.IPVersion)
+	binary, familyArgs, err := tracerouteBinary(strings.Contains(destIP, ":"))
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutSecs := opts.TimeoutMs / 1000
+	if timeoutSecs < 1 {
+		timeoutSecs = 1
+	}
+
+	return &execProber{
+		binary:      binary,
+		familyArgs:  familyArgs,
+		destIP:      destIP,
+		timeoutSecs: timeoutSecs,
+	}, nil
+}
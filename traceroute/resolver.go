@@ -0,0 +1,288 @@
+package traceroute
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDNSTimeoutMs bounds a reverse-DNS lookup when Options.DNSTimeoutMs
+// is not set.
+const DefaultDNSTimeoutMs = 2000
+
+// Cache lifetimes.  PTR answers do not come with their TTL through the
+// standard library, so fixed ones are used; addresses without a name are
+// retried sooner.
+const (
+	nameTTL     = 24 * time.Hour
+	noNameTTL   = time.Hour
+	cachedNames = 4096 // in memory, least recently used evicted first
+)
+
+// NameStore persists reverse-DNS answers beyond the in-memory cache, so that
+// they survive restarts.  LoadName returns a zero expiry when it has no
+// answer for ip.  An empty name is a cached "no PTR record".
+type NameStore interface {
+	LoadName(ip string) (name string, expires time.Time, err error)
+	SaveName(ip, name string, expires time.Time) error
+}
+
+// Resolver looks up the hostnames of hop addresses, caching answers in
+// memory and, when it has one, in a NameStore.  Concurrent lookups of the
+// same address share one query.  It is safe for concurrent use.
+type Resolver struct {
+	store NameStore
+
+	mu       sync.Mutex
+	order    *list.List // of *cachedName, most recently used first
+	byIP     map[string]*list.Element
+	inflight map[string]*nameCall
+}
+
+type cachedName struct {
+	ip      string
+	name    string
+	expires time.Time
+}
+
+type nameCall struct {
+	done chan struct{}
+	name string
+}
+
+// NewResolver returns a resolver backed by store, which may be nil.
+func NewResolver(store NameStore) *Resolver {
+	return &Resolver{
+		store:    store,
+		order:    list.New(),
+		byIP:     map[string]*list.Element{},
+		inflight: map[string]*nameCall{},
+	}
+}
+
+// defaultResolver serves traces run without Options.Resolver.
+var defaultResolver = NewResolver(nil)
+
+// Cached returns the cached hostname of ip, and false if it must be looked
+// up.  An address known to have no name returns "" and true.
+func (r *Resolver) Cached(ip string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.byIP[ip]; ok {
+		c := el.Value.(*cachedName)
+		if time.Now().Before(c.expires) {
+			r.order.MoveToFront(el)
+			return c.name, true
+		}
+		r.order.Remove(el)
+		delete(r.byIP, ip)
+	}
+	return "", false
+}
+
+// Lookup returns the hostname of ip, or "" if it has none or the lookup
+// failed.  server is the DNS server to ask, as "host" or "host:port"; empty
+// means the system resolver.  A lookup gives up after timeout.
+func (r *Resolver) Lookup(ctx context.Context, ip, server string, timeout time.Duration) string {
+	if ip == "" {
+		return ""
+	}
+	if name, ok := r.Cached(ip); ok {
+		return name
+	}
+
+	r.mu.Lock()
+	if call, ok := r.inflight[ip]; ok {
+		r.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.name
+		case <-ctx.Done():
+			return ""
+		}
+	}
+	call := &nameCall{done: make(chan struct{})}
+	r.inflight[ip] = call
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.inflight, ip)
+		r.mu.Unlock()
+		close(call.done)
+	}()
+
+	if r.store != nil {
+		if name, expires, err := r.store.LoadName(ip); err == nil && time.Now().Before(expires) {
+			r.remember(ip, name, expires)
+			call.name = name
+			return name
+		}
+	}
+
+	name, err := lookupAddr(ctx, ip, server, timeout)
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		r.save(ip, name, time.Now().Add(nameTTL))
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		r.save(ip, "", time.Now().Add(noNameTTL))
+	default:
+		// Timeouts and unreachable servers say nothing about the
+		// address; try again next time.
+	}
+	call.name = name
+	return name
+}
+
+func (r *Resolver) save(ip, name string, expires time.Time) {
+	r.remember(ip, name, expires)
+	if r.store != nil {
+		_ = r.store.SaveName(ip, name, expires)
+	}
+}
+
+// remember adds an answer to the in-memory cache.
+func (r *Resolver) remember(ip, name string, expires time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.byIP[ip]; ok {
+		r.order.Remove(el)
+	}
+	r.byIP[ip] = r.order.PushFront(&cachedName{ip: ip, name: name, expires: expires})
+	for r.order.Len() > cachedNames {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.byIP, oldest.Value.(*cachedName).ip)
+	}
+}
+
+// lookupAddr performs one PTR query.
+func lookupAddr(ctx context.Context, ip, server string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resolver := net.DefaultResolver
+	if server != "" {
+		addr := server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			addr = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	names, err := resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", &net.DNSError{Err: "no PTR record", Name: ip, IsNotFound: true}
+	}
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+// hostnames fills in the names of a run's hops.  With an OnHostname callback,
+// names not yet cached are looked up in the background and delivered through
+// it; otherwise each lookup is waited for.
+type hostnames struct {
+	ctx      context.Context // not cancelled by Stop, so names still arrive
+	resolver *Resolver
+	server   string
+	timeout  time.Duration
+	onName   func(ttl int, ip, hostname string)
+
+	mu      sync.Mutex
+	pending map[pendingName]bool
+	wg      sync.WaitGroup
+}
+
+// pendingName is an address being looked up for a TTL.
+type pendingName struct {
+	ttl int
+	ip  string
+}
+
+func newHostnames(ctx context.Context, opts *Options) *hostnames {
+	h := &hostnames{
+		ctx:      context.WithoutCancel(ctx),
+		resolver: opts.Resolver,
+		server:   opts.DNSServer,
+		timeout:  time.Duration(opts.DNSTimeoutMs) * time.Millisecond,
+		onName:   opts.OnHostname,
+		pending:  map[pendingName]bool{},
+	}
+	if h.resolver == nil {
+		h.resolver = defaultResolver
+	}
+	if h.timeout <= 0 {
+		h.timeout = DefaultDNSTimeoutMs * time.Millisecond
+	}
+	return h
+}
+
+// fill sets the hostnames of hop and its responders where the prober did not
+// supply them.
+func (h *hostnames) fill(hop *Hop) {
+	for i := range hop.Responders {
+		r := &hop.Responders[i]
+		if r.Hostname == "" {
+			r.Hostname = h.name(hop.TTL, r.IP)
+		}
+		if r.IP == hop.IP && hop.Hostname == "" {
+			hop.Hostname = r.Hostname
+		}
+	}
+	if hop.Success && hop.Hostname == "" {
+		hop.Hostname = h.name(hop.TTL, hop.IP)
+	}
+}
+
+// name returns the cached name of ip or, without a callback, looks it up.
+// With one, it starts a background lookup for ttl and returns "".
+func (h *hostnames) name(ttl int, ip string) string {
+	if ip == "" {
+		return ""
+	}
+	if name, ok := h.resolver.Cached(ip); ok || h.onName == nil {
+		if !ok {
+			name = h.resolver.Lookup(h.ctx, ip, h.server, h.timeout)
+		}
+		return name
+	}
+
+	key := pendingName{ttl, ip}
+	h.mu.Lock()
+	if h.pending[key] {
+		h.mu.Unlock()
+		return ""
+	}
+	h.pending[key] = true
+	h.mu.Unlock()
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		name := h.resolver.Lookup(h.ctx, ip, h.server, h.timeout)
+		h.mu.Lock()
+		delete(h.pending, key)
+		h.mu.Unlock()
+		if name != "" {
+			h.onName(ttl, ip, name)
+		}
+	}()
+	return ""
+}
+
+// wait returns once every background lookup has finished.
+func (h *hostnames) wait() {
+	h.wg.Wait()
+}
@@ -0,0 +1,158 @@
+package traceroute
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// DefaultProbes is the number of probes sent per TTL by DefaultOptions.
+const DefaultProbes = 3
+
+// probeTTL sends opts.Probes probes for one TTL, one after the other so that
+// routers rate-limiting ICMP don't see a burst, and summarises them into a
+// single Hop.
+func probeTTL(ctx context.Context, prober Prober, ttl int, opts *Options) Hop {
+	n := opts.Probes
+	if n < 1 {
+		n = 1
+	}
+	results := make([]Hop, 0, n)
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, prober.Probe(ctx, ttl))
+	}
+	return summarize(ttl, results)
+}
+
+// summarize folds the individual probe results for one TTL into a Hop.  The
+// address, hostname and RTT fields come from the first probe that was
+// answered; the statistics cover all of them.  Probes that went unanswered
+// are zero Hops.
+func summarize(ttl int, results []Hop) Hop {
+	var hop Hop
+	var stats rttStats
+	for _, r := range results {
+		if r.Success && stats.received == 0 {
+			hop = r
+		}
+		if r.Success && r.IsFinal {
+			hop.IsFinal = true
+		}
+		stats.add(r)
+	}
+	hop.TTL = ttl
+	stats.apply(&hop)
+	if stats.received > 0 {
+		hop.RTT = stats.first
+	}
+	return hop
+}
+
+// rttStats accumulates probe results for one TTL.  It is used both for the
+// probes of a single pass and, in continuous mode, across every round.
+type rttStats struct {
+	sent, received int
+
+	first, last float64 // RTT of the first and the most recent answered probe
+	min, max    float64
+	mean, m2    float64 // running mean and sum of squared deviations (Welford)
+	jitterSum   float64 // sum of |RTT - previous RTT| over answered probes
+
+	responders []*responderStats // in order of first answer
+}
+
+// responderStats accumulates the probes answered by one address.
+type responderStats struct {
+	ip, hostname  string
+	count         int
+	min, max, sum float64
+}
+
+// add records one probe result; unanswered probes are zero Hops.
+func (s *rttStats) add(h Hop) {
+	s.sent++
+	if !h.Success {
+		return
+	}
+	rtt := h.RTT
+	s.received++
+	if s.received == 1 {
+		s.first, s.min, s.max = rtt, rtt, rtt
+	} else {
+		s.jitterSum += math.Abs(rtt - s.last)
+		s.min = math.Min(s.min, rtt)
+		s.max = math.Max(s.max, rtt)
+	}
+	s.last = rtt
+
+	delta := rtt - s.mean
+	s.mean += delta / float64(s.received)
+	s.m2 += delta * (rtt - s.mean)
+
+	if h.IP == "" {
+		return
+	}
+	var r *responderStats
+	for _, existing := range s.responders {
+		if existing.ip == h.IP {
+			r = existing
+			break
+		}
+	}
+	if r == nil {
+		r = &responderStats{ip: h.IP, min: rtt, max: rtt}
+		s.responders = append(s.responders, r)
+	}
+	if r.hostname == "" {
+		r.hostname = h.Hostname
+	}
+	r.count++
+	r.sum += rtt
+	r.min = math.Min(r.min, rtt)
+	r.max = math.Max(r.max, rtt)
+}
+
+// apply writes the accumulated statistics into hop.  RTT is set to the most
+// recent answered probe; Success and IsTimeout follow whether any probe was
+// answered at all.
+func (s *rttStats) apply(hop *Hop) {
+	hop.Sent = s.sent
+	hop.Received = s.received
+	hop.Loss = 0
+	if s.sent > 0 {
+		hop.Loss = float64(s.sent-s.received) / float64(s.sent) * 100
+	}
+	hop.Success = s.received > 0
+	hop.IsTimeout = s.received == 0
+	if s.received == 0 {
+		return
+	}
+	hop.RTT = s.last
+	hop.MinRTT = s.min
+	hop.AvgRTT = s.mean
+	hop.MaxRTT = s.max
+	hop.StdDevRTT = math.Sqrt(s.m2 / float64(s.received))
+	hop.Jitter = 0
+	if s.received > 1 {
+		hop.Jitter = s.jitterSum / float64(s.received-1)
+	}
+
+	hop.Responders = make([]Responder, len(s.responders))
+	for i, r := range s.responders {
+		hop.Responders[i] = Responder{
+			IP:       r.ip,
+			Hostname: r.hostname,
+			Count:    r.count,
+			MinRTT:   r.min,
+			AvgRTT:   r.sum / float64(r.count),
+			MaxRTT:   r.max,
+		}
+	}
+	// Most frequent responder first; ties keep first-answer order.
+	sort.SliceStable(hop.Responders, func(i, j int) bool {
+		return hop.Responders[i].Count > hop.Responders[j].Count
+	})
+}
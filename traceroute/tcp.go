@@ -0,0 +1,210 @@
+//go:build !windows
+
+package traceroute
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+)
+
+// tcpProber traces with TCP SYNs to a single destination port, which gets
+// through firewalls that drop ICMP and UDP.  Each probe is an ordinary
+// connect() on a fresh socket whose TTL has been lowered, so the kernel
+// builds the SYN and tells us how the handshake ended: a SYN-ACK means the
+// destination was reached and the port is open, a RST that it was reached and
+// the port is closed.  Routers on the way answer with ICMP Time Exceeded,
+// matched back to the probe by the quoted source port; those can only be seen
+// with a raw ICMP socket, without one the intermediate hops time out.
+type tcpProber struct {
+	listener *icmpListener // nil without a raw ICMP socket
+	destIP   net.IP
+	port     int
+	timeout  time.Duration
+}
+
+func newTCPProber(dest string, opts *Options) (Prober, error) {
+	if opts.Paris {
+		return nil, errors.New("paris mode is not supported for tcp probes")
+	}
+	destIP, err := resolveDest(dest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	port := opts.Port
+	if port <= 0 {
+		port = DefaultTCPPort
+	}
+
+	p := &tcpProber{
+		destIP:  destIP,
+		port:    port,
+		timeout: probeTimeout(opts),
+	}
+	if conn, raw, err := listenICMP(familyOf(destIP), false); err == nil {
+		p.listener = &icmpListener{conn: conn, raw: raw, family: familyOf(destIP), classify: p.match}
+		p.listener.start()
+	}
+	return p, nil
+}
+
+// Close releases the ICMP socket, if any.
+func (p *tcpProber) Close() error {
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.conn.Close()
+}
+
+// Probe attempts one connection with the given TTL and reports whoever
+// answered first.  It returns a zero Hop on timeout.
+func (p *tcpProber) Probe(ctx context.Context, ttl int) Hop {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// Control runs on the dialing goroutine; it hands the probe's source
+	// port and reply channel over through started once the socket is ready.
+	type probeStart struct {
+		srcPort uint16
+		replies chan icmpReply
+		sent    time.Time
+	}
+	started := make(chan probeStart, 1)
+	dialer := net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var srcPort uint16
+			var err error
+			cerr := c.Control(func(fd uintptr) {
+				if err = bindWithTTL(int(fd), ttl, network == "tcp6"); err != nil {
+					return
+				}
+				var sa syscall.Sockaddr
+				if sa, err = syscall.Getsockname(int(fd)); err != nil {
+					return
+				}
+				switch sa := sa.(type) {
+				case *syscall.SockaddrInet4:
+					srcPort = uint16(sa.Port)
+				case *syscall.SockaddrInet6:
+					srcPort = uint16(sa.Port)
+				}
+			})
+			if cerr != nil {
+				return cerr
+			}
+			if err != nil {
+				return err
+			}
+			var replies chan icmpReply
+			if p.listener != nil {
+				replies = p.listener.register(srcPort)
+			}
+			started <- probeStart{srcPort, replies, time.Now()}
+			return nil
+		},
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+		at   time.Time
+	}
+	done := make(chan result, 1)
+	go func() {
+		network := "tcp4"
+		if p.destIP.To4() == nil {
+			network = "tcp6"
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(p.destIP.String(), strconv.Itoa(p.port)))
+		done <- result{conn, err, time.Now()}
+	}()
+
+	var (
+		start   probeStart
+		replies <-chan icmpReply
+		hop     Hop
+	)
+	reached := func(at time.Time, state string) Hop {
+		return Hop{
+			TTL:       ttl,
+			IP:        p.destIP.String(),
+			RTT:       float64(at.Sub(start.sent).Microseconds()) / 1000,
+			Success:   true,
+			IsFinal:   true,
+			PortState: state,
+		}
+	}
+	for {
+		select {
+		case start = <-started:
+			replies = start.replies
+		case r := <-done:
+			select {
+			case start = <-started: // Control finished before the dial did
+			default:
+			}
+			if start.replies != nil {
+				p.listener.unregister(start.srcPort)
+			}
+			switch {
+			case r.err == nil:
+				if tc, ok := r.conn.(*net.TCPConn); ok {
+					_ = tc.SetLinger(0) // reset rather than linger in FIN_WAIT
+				}
+				r.conn.Close()
+				return reached(r.at, PortOpen)
+			case errors.Is(r.err, syscall.ECONNREFUSED):
+				return reached(r.at, PortClosed)
+			}
+			return hop
+		case reply := <-replies:
+			hop = Hop{
+				TTL:     ttl,
+				IP:      reply.peer.String(),
+				RTT:     float64(reply.receive.Sub(start.sent).Microseconds()) / 1000,
+				Success: true,
+				IsFinal: reply.final,
+				MPLS:    reply.mpls,
+			}
+			replies = nil
+			cancel() // the SYN died on the way; stop the kernel retrying it
+		}
+	}
+}
+
+// match keys ICMP errors by the quoted TCP source port, ignoring segments
+// that were not sent to our destination port.
+func (p *tcpProber) match(msg *icmp.Message) (uint16, bool, bool) {
+	f := p.listener.family
+	if msg.Type != f.timeExceeded && msg.Type != f.dstUnreach {
+		return 0, false, false
+	}
+	inner, dst, ok := quoted(msg, protocolTCP)
+	if !ok || !dst.Equal(p.destIP) || int(binary.BigEndian.Uint16(inner[2:4])) != p.port {
+		return 0, false, false
+	}
+	return binary.BigEndian.Uint16(inner[0:2]), false, true
+}
+
+// bindWithTTL sets the TTL (or IPv6 unicast hop limit) on a socket and binds
+// it to an ephemeral port, so the source port is known before the SYN goes
+// out.
+func bindWithTTL(fd, ttl int, v6 bool) error {
+	if v6 {
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl); err != nil {
+			return err
+		}
+		return syscall.Bind(fd, &syscall.SockaddrInet6{})
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TTL, ttl); err != nil {
+		return err
+	}
+	return syscall.Bind(fd, &syscall.SockaddrInet4{})
+}
@@ -0,0 +1,10 @@
+package traceroute
+
+import "errors"
+
+// newTCPProber is unavailable on Windows: the Go runtime binds sockets itself
+// before ConnectEx, so the source port cannot be learned ahead of the SYN,
+// and Windows does not allow sending raw TCP.
+func newTCPProber(dest string, opts *Options) (Prober, error) {
+	return nil, errors.New("tcp probing is not supported on Windows")
+}
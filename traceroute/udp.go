@@ -0,0 +1,199 @@
+package traceroute
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DefaultUDPPort is the first destination port used by UDP probes, as in
+// classic traceroute.
+const DefaultUDPPort = 33434
+
+// DefaultTCPPort is the destination port used by TCP probes.
+const DefaultTCPPort = 80
+
+// udpProber sends classic traceroute UDP datagrams from one socket, moving to
+// the next free destination port for every probe, and matches the ICMP
+// errors they provoke by the destination port quoted back.  Routers on the way
+// answer with Time Exceeded; the destination answers with Port Unreachable,
+// since nothing listens on those ports.
+//
+// In Paris mode the destination port is Port+flow instead, constant for a
+// flow, and probes are matched by the identifier in their quoted payload.
+type udpProber struct {
+	icmpListener
+	udp       *net.UDPConn
+	setTTL    func(ttl int) error // on udp, not on the ICMP listener
+	destIP    net.IP
+	localPort int
+	timeout   time.Duration
+
+	basePort  int
+	portRange int
+
+	// writeMu serialises SetTTL+WriteTo, as for icmpProber.
+	writeMu sync.Mutex
+
+	seqMu    sync.Mutex
+	seq      int
+	inFlight map[int]bool // destination ports of unanswered probes
+
+	flows *flowPicker // nil unless Options.Paris
+}
+
+// newUDPProber opens the UDP sending socket and a raw ICMP socket to receive
+// the replies on.  Unlike Echo probing, this always needs a raw socket.
+func newUDPProber(dest string, opts *Options) (*udpProber, error) {
+	destIP, err := resolveDest(dest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	basePort := opts.Port
+	if basePort <= 0 {
+		basePort = DefaultUDPPort
+	}
+	portRange := opts.PortRange
+	if portRange <= 0 || basePort+portRange > 65536 {
+		portRange = 65536 - basePort
+	}
+	// Every TTL has a probe in flight at once, and each needs a port of
+	// its own for its reply to be told apart.
+	if inFlight := max(opts.MaxHops, 1); !opts.Paris && portRange < inFlight {
+		return nil, fmt.Errorf("udp port range %d is smaller than the %d probes in flight, one per TTL", portRange, inFlight)
+	}
+
+	family := familyOf(destIP)
+	conn, raw, err := listenICMP(family, false)
+	if err != nil {
+		return nil, fmt.Errorf("udp probing needs a raw ICMP socket: %w", err)
+	}
+	network := "udp4"
+	if family.v6 {
+		network = "udp6"
+	}
+	udp, err := net.ListenUDP(network, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p := &udpProber{
+		udp:       udp,
+		setTTL:    ipv4.NewPacketConn(udp).SetTTL,
+		destIP:    destIP,
+		localPort: udp.LocalAddr().(*net.UDPAddr).Port,
+		timeout:   probeTimeout(opts),
+		basePort:  basePort,
+		portRange: portRange,
+		inFlight:  map[int]bool{},
+	}
+	if family.v6 {
+		p.setTTL = ipv6.NewPacketConn(udp).SetHopLimit
+	}
+	if opts.Paris {
+		p.flows = newFlowPicker(opts)
+	}
+	p.conn, p.raw, p.family = conn, raw, family
+	p.classify = p.match
+	p.start()
+	return p, nil
+}
+
+// Close releases both sockets.
+func (p *udpProber) Close() error {
+	p.udp.Close()
+	return p.conn.Close()
+}
+
+// Probe sends one datagram with the given TTL to the next free port in the
+// range and waits for the ICMP error it provokes.  It returns a zero Hop on
+// timeout.
+func (p *udpProber) Probe(ctx context.Context, ttl int) Hop {
+	seq, port, ok := p.nextPort()
+	if !ok {
+		return Hop{}
+	}
+	defer p.releasePort(port)
+
+	key := uint16(port)
+	payload := []byte("traceroute")
+	if p.flows != nil {
+		port = p.basePort + p.flows.id(p.flows.next(ttl))%p.portRange
+		key = uint16(seq)
+		payload = parisUDPData(key)
+	}
+
+	ch := p.register(key)
+	defer p.unregister(key)
+
+	p.writeMu.Lock()
+	if err := p.setTTL(ttl); err != nil {
+		p.writeMu.Unlock()
+		return Hop{}
+	}
+	sent := time.Now()
+	_, err := p.udp.WriteTo(payload, &net.UDPAddr{IP: p.destIP, Port: port})
+	p.writeMu.Unlock()
+	if err != nil {
+		return Hop{}
+	}
+
+	return await(ctx, ch, ttl, sent, p.timeout)
+}
+
+// nextPort numbers a probe and picks the next port in the range that no
+// unanswered probe is using.  A slow probe keeps its port while later ones
+// wrap around the range, so taking ports in turn alone could give two
+// probes the same one.  In Paris mode ports are per flow and not reserved.
+func (p *udpProber) nextPort() (seq, port int, ok bool) {
+	p.seqMu.Lock()
+	defer p.seqMu.Unlock()
+	for range p.portRange {
+		seq = p.seq
+		p.seq++
+		port = p.basePort + seq%p.portRange
+		if p.flows != nil || !p.inFlight[port] {
+			if p.flows == nil {
+				p.inFlight[port] = true
+			}
+			return seq, port, true
+		}
+	}
+	return 0, 0, false
+}
+
+func (p *udpProber) releasePort(port int) {
+	p.seqMu.Lock()
+	delete(p.inFlight, port)
+	p.seqMu.Unlock()
+}
+
+// match keys replies by the quoted UDP destination port (or payload
+// identifier, in Paris mode), ignoring datagrams that were not sent from our socket to our
+// destination.
+func (p *udpProber) match(msg *icmp.Message) (uint16, bool, bool) {
+	if msg.Type != p.family.timeExceeded && msg.Type != p.family.dstUnreach {
+		return 0, false, false
+	}
+	inner, dst, ok := quoted(msg, protocolUDP)
+	if !ok || !dst.Equal(p.destIP) || int(binary.BigEndian.Uint16(inner[0:2])) != p.localPort {
+		return 0, false, false
+	}
+	final := msg.Type == p.family.dstUnreach && msg.Code == p.family.portUnreachable
+	if p.flows != nil {
+		if len(inner) < 10 {
+			return 0, false, false // the router quoted no payload
+		}
+		return binary.BigEndian.Uint16(inner[8:10]), final, true
+	}
+	return binary.BigEndian.Uint16(inner[2:4]), final, true
+}
@@ -0,0 +1,39 @@
+package traceroute
+
+import "testing"
+
+func TestUDPPortsNotShared(t *testing.T) {
+	p := &udpProber{basePort: 33434, portRange: 3, inFlight: map[int]bool{}}
+	var ports []int
+	for range 3 {
+		_, port, ok := p.nextPort()
+		if !ok {
+			t.Fatal("no free port")
+		}
+		ports = append(ports, port)
+	}
+	if want := []int{33434, 33435, 33436}; ports[0] != want[0] || ports[1] != want[1] || ports[2] != want[2] {
+		t.Fatalf("ports = %v, want %v", ports, want)
+	}
+	if _, port, ok := p.nextPort(); ok {
+		t.Fatalf("got port %d with every port in flight", port)
+	}
+
+	// The first probe is still waiting; the range wraps past it.
+	p.releasePort(33435)
+	p.releasePort(33436)
+	for _, want := range []int{33435, 33436} {
+		if _, port, ok := p.nextPort(); !ok || port != want {
+			t.Fatalf("nextPort = %d, %v; want %d", port, ok, want)
+		}
+	}
+}
+
+func TestUDPPortRangeTooSmall(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PortRange = 1
+	if p, err := newUDPProber("127.0.0.1", opts); err == nil {
+		p.Close()
+		t.Fatal("a one-port range was accepted for 30 hops")
+	}
+}